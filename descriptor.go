@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Descriptor describes the layout of stripes made by an XRS codec.
+// Persist it with stripes, so they'll always be decoded in the same way.
+type Descriptor struct {
+	DataNum         int
+	ParityNum       int
+	XORSetAlgorithm int // XORSetAlgorithm is the algorithm of making XORSet, e.g., XORSetRoundRobin.
+	Substripes      int
+	VectSize        int
+
+	// XORSet is the XORSet when XORSetAlgorithm is XORSetCustom, otherwise it's nil.
+	XORSet map[int][]int
+}
+
+// XORSet algorithms.
+const (
+	// XORSetRoundRobin is the XORSet made by New and NewWithSubstripes.
+	XORSetRoundRobin = 1
+	// XORSetCustom is the XORSet given by caller (e.g., NewWithXORSet).
+	XORSetCustom = 2
+)
+
+const (
+	descriptorMagic   = "XRSD"
+	descriptorVersion = 1
+	descriptorSize    = 20 // Without XORSet of XORSetCustom.
+)
+
+// Descriptor returns the Descriptor of stripes made by x with vectSize.
+func (x *XRS) Descriptor(vectSize int) (desc Descriptor, err error) {
+
+	if vectSize <= 0 {
+		err = fmt.Errorf("%w: %d", ErrOddVectSize, vectSize)
+		return
+	}
+	err = x.checkSize(vectSize)
+	if err != nil {
+		return
+	}
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	desc = Descriptor{
+		DataNum:         d,
+		ParityNum:       p,
+		XORSetAlgorithm: XORSetRoundRobin,
+		Substripes:      x.substripes(),
+		VectSize:        vectSize,
+	}
+
+	rr := make(map[int][]int)
+	makeXORSet(d, p, rr)
+	xs := copyXORSet(x.XORSet)
+	if !equalXORSet(rr, xs) {
+		err = CheckXORSet(d, p, xs)
+		if err != nil {
+			return Descriptor{}, err
+		}
+		desc.XORSetAlgorithm = XORSetCustom
+		desc.XORSet = xs
+	}
+	return
+}
+
+// NewFromDescriptor creates an XRS codec which decodes stripes described by desc.
+// It returns error if the layout is not supported by this version.
+func NewFromDescriptor(desc Descriptor) (x *XRS, err error) {
+
+	switch desc.XORSetAlgorithm {
+	case XORSetRoundRobin:
+		x, err = newXRS(desc.DataNum, desc.ParityNum, desc.Substripes, nil)
+	case XORSetCustom:
+		if desc.XORSet == nil {
+			return nil, fmt.Errorf("%w: nil", ErrIllegalXORSet)
+		}
+		x, err = newXRS(desc.DataNum, desc.ParityNum, desc.Substripes, desc.XORSet)
+	default:
+		err = fmt.Errorf("%w: unknown XORSet algorithm: %d", ErrIllegalDescriptor, desc.XORSetAlgorithm)
+	}
+	if err != nil {
+		return
+	}
+	if desc.VectSize <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrOddVectSize, desc.VectSize)
+	}
+	err = x.checkSize(desc.VectSize)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// Format (little-endian):
+// magic "XRSD" | version(1) | XORSetAlgorithm(1) | DataNum(2) | ParityNum(2) | Substripes(2) | VectSize(8)
+// and with XORSetCustom, the XORSet key of each data index follows (2 bytes each).
+func (desc *Descriptor) MarshalBinary() (data []byte, err error) {
+
+	fields := []int{desc.XORSetAlgorithm, desc.DataNum, desc.ParityNum, desc.Substripes}
+	limits := []int{1<<8 - 1, 1<<16 - 1, 1<<16 - 1, 1<<16 - 1}
+	for i, f := range fields {
+		if f < 0 || f > limits[i] {
+			return nil, fmt.Errorf("%w: %+v", ErrIllegalDescriptor, *desc)
+		}
+	}
+	if desc.VectSize < 0 {
+		return nil, fmt.Errorf("%w: %+v", ErrIllegalDescriptor, *desc)
+	}
+
+	size := descriptorSize
+	if desc.XORSetAlgorithm == XORSetCustom {
+		err = CheckXORSet(desc.DataNum, desc.ParityNum, desc.XORSet)
+		if err != nil {
+			return
+		}
+		size += 2 * desc.DataNum
+	}
+
+	data = make([]byte, size)
+	copy(data, descriptorMagic)
+	data[4] = descriptorVersion
+	data[5] = uint8(desc.XORSetAlgorithm)
+	binary.LittleEndian.PutUint16(data[6:8], uint16(desc.DataNum))
+	binary.LittleEndian.PutUint16(data[8:10], uint16(desc.ParityNum))
+	binary.LittleEndian.PutUint16(data[10:12], uint16(desc.Substripes))
+	binary.LittleEndian.PutUint64(data[12:20], uint64(desc.VectSize))
+	if desc.XORSetAlgorithm == XORSetCustom {
+		for k, v := range desc.XORSet {
+			for _, i := range v {
+				binary.LittleEndian.PutUint16(data[descriptorSize+2*i:], uint16(k))
+			}
+		}
+	}
+	return
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (desc *Descriptor) UnmarshalBinary(data []byte) error {
+
+	if len(data) < 5 || string(data[:4]) != descriptorMagic {
+		return fmt.Errorf("%w: bad magic", ErrIllegalDescriptor)
+	}
+	if data[4] != descriptorVersion {
+		return fmt.Errorf("%w: unknown version: %d", ErrIllegalDescriptor, data[4])
+	}
+	if len(data) < descriptorSize {
+		return fmt.Errorf("%w: size: %d", ErrIllegalDescriptor, len(data))
+	}
+	alg := int(data[5])
+	dataNum := int(binary.LittleEndian.Uint16(data[6:8]))
+	size := descriptorSize
+	if alg == XORSetCustom {
+		size += 2 * dataNum
+	}
+	if len(data) != size {
+		return fmt.Errorf("%w: size: %d", ErrIllegalDescriptor, len(data))
+	}
+	vs := binary.LittleEndian.Uint64(data[12:20])
+	if vs > 1<<62 {
+		return fmt.Errorf("%w: vect size: %d", ErrIllegalDescriptor, vs)
+	}
+
+	desc.XORSetAlgorithm = alg
+	desc.DataNum = dataNum
+	desc.ParityNum = int(binary.LittleEndian.Uint16(data[8:10]))
+	desc.Substripes = int(binary.LittleEndian.Uint16(data[10:12]))
+	desc.VectSize = int(vs)
+	desc.XORSet = nil
+	if alg == XORSetCustom {
+		desc.XORSet = make(map[int][]int)
+		for i := 0; i < dataNum; i++ {
+			k := int(binary.LittleEndian.Uint16(data[descriptorSize+2*i:]))
+			desc.XORSet[k] = append(desc.XORSet[k], i)
+		}
+	}
+	return nil
+}
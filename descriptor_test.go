@@ -0,0 +1,196 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"testing"
+)
+
+func TestDescriptor(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vectSize := sub * 64
+		desc, err := x.Descriptor(vectSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := desc.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var desc2 Descriptor
+		err = desc2.UnmarshalBinary(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalDescriptor(desc, desc2) {
+			t.Fatalf("mismatch descriptor: %+v, exp: %+v", desc2, desc)
+		}
+
+		x2, err := NewFromDescriptor(desc2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := newShardMatrix(d+p, vectSize)
+		act := newShardMatrix(d+p, vectSize)
+		for j := 0; j < d; j++ {
+			fillRandom(t, r, exp[j])
+			copy(act[j], exp[j])
+		}
+		err = x.Encode(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = x2.Encode(act)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertVectsEqual(t, exp, act, "encode by descriptor")
+	}
+}
+
+func TestDescriptorIllegal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 3} {
+		_, err = x.Descriptor(size)
+		if err == nil {
+			t.Fatalf("vect size %d should be illegal", size)
+		}
+	}
+
+	desc, err := x.Descriptor(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := desc.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := [][]byte{
+		nil,
+		b[:len(b)-1],
+		append(append([]byte(nil), b...), 0),
+		append([]byte("XRSX"), b[4:]...),
+		append(append([]byte(nil), b[:4]...), append([]byte{descriptorVersion + 1}, b[5:]...)...),
+	}
+	for i, bb := range bad {
+		var desc2 Descriptor
+		if desc2.UnmarshalBinary(bb) == nil {
+			t.Fatalf("case %d should be illegal", i)
+		}
+	}
+
+	illegal := []Descriptor{
+		{DataNum: d, ParityNum: p, XORSetAlgorithm: XORSetRoundRobin + 100, Substripes: 2, VectSize: 64},
+		{DataNum: d, ParityNum: p, XORSetAlgorithm: XORSetRoundRobin, Substripes: p + 1, VectSize: 64},
+		{DataNum: d, ParityNum: p, XORSetAlgorithm: XORSetRoundRobin, Substripes: 2, VectSize: 3},
+		{DataNum: d, ParityNum: 0, XORSetAlgorithm: XORSetRoundRobin, Substripes: 2, VectSize: 64},
+	}
+	for i, desc := range illegal {
+		_, err = NewFromDescriptor(desc)
+		if err == nil {
+			t.Fatalf("case %d should be illegal", i)
+		}
+	}
+
+	// XORSet broken by caller.
+	delete(x.XORSet, d+1)
+	_, err = x.Descriptor(64)
+	if err == nil {
+		t.Fatal("should return error for illegal XORSet")
+	}
+
+	illegal = []Descriptor{
+		{DataNum: 2, ParityNum: 3, XORSetAlgorithm: XORSetCustom, Substripes: 2, VectSize: 64},
+		{DataNum: 2, ParityNum: 3, XORSetAlgorithm: XORSetCustom, Substripes: 2, VectSize: 64,
+			XORSet: map[int][]int{3: {0, 1}, 4: {1}}},
+	}
+	for i, desc := range illegal {
+		_, err = NewFromDescriptor(desc)
+		if err == nil {
+			t.Fatalf("custom case %d should be illegal", i)
+		}
+		_, err = desc.MarshalBinary()
+		if err == nil {
+			t.Fatalf("custom case %d should be illegal to marshal", i)
+		}
+	}
+}
+
+func TestDescriptorCustomXORSet(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	// Swap the round-robin groups, it's still legal but not round-robin.
+	set := make(map[int][]int)
+	makeXORSet(d, p, set)
+	set[d+1], set[d+2] = set[d+2], set[d+1]
+	x, err := NewWithXORSet(d, p, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := x.Descriptor(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.XORSetAlgorithm != XORSetCustom {
+		t.Fatalf("XORSet algorithm mismatch: %d, exp: %d", desc.XORSetAlgorithm, XORSetCustom)
+	}
+	b, err := desc.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != descriptorSize+2*d {
+		t.Fatalf("descriptor size mismatch: %d, exp: %d", len(b), descriptorSize+2*d)
+	}
+	var desc2 Descriptor
+	err = desc2.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalDescriptor(desc, desc2) {
+		t.Fatalf("mismatch descriptor: %+v, exp: %+v", desc2, desc)
+	}
+	if desc2.UnmarshalBinary(b[:descriptorSize]) == nil {
+		t.Fatal("truncated custom descriptor should be illegal")
+	}
+
+	x2, err := NewFromDescriptor(desc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := newShardMatrix(d+p, 64)
+	act := newShardMatrix(d+p, 64)
+	for j := 0; j < d; j++ {
+		fillRandom(t, r, exp[j])
+		copy(act[j], exp[j])
+	}
+	err = x.Encode(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = x2.Encode(act)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVectsEqual(t, exp, act, "encode by custom descriptor")
+}
+
+func equalDescriptor(a, b Descriptor) bool {
+	return a.DataNum == b.DataNum && a.ParityNum == b.ParityNum &&
+		a.XORSetAlgorithm == b.XORSetAlgorithm && a.Substripes == b.Substripes &&
+		a.VectSize == b.VectSize && equalXORSet(a.XORSet, b.XORSet)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"errors"
+
+	rs "github.com/templexxx/reedsolomon"
+)
+
+// Errors returned by XRS, use errors.Is for checking them,
+// because most of them are wrapped with details.
+//
+// Errors of the backend Reed-Solomon codec are wrapped too,
+// e.g., both errors.Is(err, ErrTooFewShards) and
+// errors.Is(err, reedsolomon.ErrTooManyLost) are true for too many lost vectors.
+var (
+	// ErrIllegalData is returned when the data number is illegal.
+	ErrIllegalData = errors.New("illegal data")
+	// ErrIllegalParity is returned when the parity number is illegal
+	// (including data+parity > 256), or the number of parity vectors given
+	// doesn't match it.
+	ErrIllegalParity = errors.New("illegal parity")
+	// ErrIllegalSubstripes is returned when the substripes is illegal.
+	ErrIllegalSubstripes = errors.New("illegal substripes")
+	// ErrIllegalXORSet is returned when the XORSet is illegal (see CheckXORSet).
+	ErrIllegalXORSet = errors.New("illegal XORSet")
+	// ErrOddVectSize is returned when the vect size is 0 or isn't
+	// a multiple of Substripes (with two halves, it must be even).
+	ErrOddVectSize = errors.New("illegal vect size")
+	// ErrIllegalIndex is returned when an index of vector is out of range,
+	// or it's not the expected kind (e.g., a parity index for data),
+	// or the indexes are conflicting.
+	ErrIllegalIndex = errors.New("illegal index")
+	// ErrTooFewShards is returned when there aren't enough vectors
+	// for the operation, e.g., too many lost or wrong number of vects.
+	ErrTooFewShards = errors.New("too few shards")
+	// ErrShardSizeMismatch is returned when vectors have different sizes.
+	ErrShardSizeMismatch = errors.New("shard size mismatch")
+	// ErrTooManyCorrupted is returned when the corrupted vectors
+	// can't be located.
+	ErrTooManyCorrupted = errors.New("too many corrupted vects")
+	// ErrIllegalDescriptor is returned when the Descriptor can't be decoded.
+	ErrIllegalDescriptor = errors.New("illegal descriptor")
+)
+
+// rsErrors maps errors of the backend codec to XRS errors.
+var rsErrors = map[error]error{
+	rs.ErrMismatchVects:     ErrTooFewShards,
+	rs.ErrZeroVectSize:      ErrOddVectSize,
+	rs.ErrMismatchVectSize:  ErrShardSizeMismatch,
+	rs.ErrIllegalVectIndex:  ErrIllegalIndex,
+	rs.ErrTooManyLost:       ErrTooFewShards,
+	rs.ErrHasLostConflict:   ErrIllegalIndex,
+	rs.ErrMismatchParityNum: ErrIllegalParity,
+	rs.ErrTooManyReplace:    ErrIllegalIndex,
+	rs.ErrMismatchReplace:   ErrIllegalIndex,
+	rs.ErrIllegalVects:      ErrIllegalParity,
+}
+
+// rsError is an error of the backend codec with its XRS error.
+type rsError struct {
+	kind error
+	err  error
+}
+
+func (e *rsError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *rsError) Unwrap() error {
+	return e.err
+}
+
+func (e *rsError) Is(target error) bool {
+	return target == e.kind
+}
+
+// wrapRS wraps err returned by the backend codec.
+func wrapRS(err error) error {
+	if err == nil {
+		return nil
+	}
+	if kind, ok := rsErrors[err]; ok {
+		return &rsError{kind: kind, err: err}
+	}
+	return err
+}
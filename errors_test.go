@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	rs "github.com/templexxx/reedsolomon"
+)
+
+func TestErrors(t *testing.T) {
+	d, p := testDataShards, testParityShards
+
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vects := newShardMatrix(d+p, 64)
+	w := x.NewWorkspace()
+
+	cases := []struct {
+		name string
+		exp  error
+		f    func() error
+	}{
+		{"data 0", ErrIllegalData, func() error { _, err := New(0, p); return err }},
+		{"parity 0", ErrIllegalParity, func() error { _, err := New(d, 0); return err }},
+		{"data+parity > 256", ErrIllegalParity, func() error { _, err := New(250, 7); return err }},
+		{"substripes", ErrIllegalSubstripes, func() error { _, err := NewWithSubstripes(d, p, p+1); return err }},
+		{"nil XORSet", ErrIllegalXORSet, func() error { _, err := NewWithXORSet(d, p, nil); return err }},
+		{"odd size", ErrOddVectSize, func() error { return x.Encode(newShardMatrix(d+p, 3)) }},
+		{"zero size", ErrOddVectSize, func() error { return x.Encode(newShardMatrix(d+p, 0)) }},
+		{"need vects", ErrIllegalIndex, func() error { _, _, err := x.GetNeedVects(d); return err }},
+		{"need vects parity", ErrIllegalIndex, func() error { _, _, err := x.GetNeedVectsParity(0); return err }},
+		{"reconst one", ErrIllegalIndex, func() error { return x.ReconstOne(vects, d) }},
+		{"reconst parity", ErrIllegalIndex, func() error { return x.ReconstParity(vects, 0) }},
+		{"too many lost", ErrTooFewShards, func() error {
+			return x.Reconst(vects, []int{0, 1, 2}, []int{3, 4, 5, 6, 7})
+		}},
+		{"conflict", ErrIllegalIndex, func() error {
+			return x.Reconst(vects, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, []int{12, 13})
+		}},
+		{"vects number", ErrTooFewShards, func() error { _, err := x.Verify(vects[:d]); return err }},
+		{"size mismatch", ErrShardSizeMismatch, func() error {
+			vs := newShardMatrix(d+p, 64)
+			vs[d+1] = vs[d+1][:32]
+			_, err := x.Verify(vs)
+			return err
+		}},
+		{"update parity", ErrIllegalParity, func() error {
+			return x.Update(vects[0], vects[1], 0, vects[d:d+1])
+		}},
+		{"replace rows", ErrIllegalIndex, func() error {
+			return x.Replace(vects[:2], []int{0}, vects[d:])
+		}},
+		{"workspace parity", ErrIllegalParity, func() error {
+			return w.Update(vects[0], vects[1], 0, vects[d:d+1])
+		}},
+		{"workspace size", ErrShardSizeMismatch, func() error {
+			return w.Update(vects[0], vects[1][:32], 0, vects[d:])
+		}},
+		{"repair plan", ErrIllegalIndex, func() error { _, err := x.RepairPlan(d+p, 64); return err }},
+		{"descriptor", ErrIllegalDescriptor, func() error { var desc Descriptor; return desc.UnmarshalBinary(nil) }},
+		{"join", ErrTooFewShards, func() error { return x.Join(new(bytes.Buffer), vects[:d], 1) }},
+		{"check XORSet", ErrIllegalXORSet, func() error { return CheckXORSet(d, p, map[int][]int{d: {0}}) }},
+	}
+	for _, c := range cases {
+		err := c.f()
+		if !errors.Is(err, c.exp) {
+			t.Fatalf("%s: mismatch error: %v, exp: %v", c.name, err, c.exp)
+		}
+	}
+}
+
+func TestErrors_Backend(t *testing.T) {
+	d, p := testDataShards, testParityShards
+
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vects := newShardMatrix(d+p, 64)
+	err = wrapRS(x.RS.Reconst(vects, []int{0, 1, 2}, []int{3, 4, 5, 6, 7}))
+	if !errors.Is(err, ErrTooFewShards) || !errors.Is(err, rs.ErrTooManyLost) {
+		t.Fatalf("backend error should be wrapped: %v", err)
+	}
+	if errors.Is(err, ErrIllegalIndex) {
+		t.Fatal("error shouldn't match other kind")
+	}
+
+	if wrapRS(nil) != nil {
+		t.Fatal("nil should not be wrapped")
+	}
+	other := errors.New("other")
+	if wrapRS(other) != other {
+		t.Fatal("unknown error should not be wrapped")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"fmt"
+	"sync"
+
+	rs "github.com/templexxx/reedsolomon"
+)
+
+// layout is what XRS has checked of RS, XORSet and Substripes.
+//
+// XORSet and Substripes are exported, so the caller could assign them
+// after New. layout is made on the first use and made again once any of
+// them is changed, so they're always checked before being used.
+type layout struct {
+	rs         *rs.RS
+	set        map[int][]int // Copy of XORSet when it's checked.
+	substripes int
+
+	terms    [][]term  // XOR terms by parity index - DataNum, see terms.
+	bNeed    [][]int   // bNeed of GetNeedVects by data index.
+	decoders sync.Map  // decodeKey -> *rs.RS, see decoder.
+	updaters sync.Map  // Bitmap of rows -> *rs.RS, see Workspace.updater.
+	plans    sync.Map  // Bitmap of lost vectors -> *multiPlan, see planMulti.
+	pool     sync.Pool // *Workspace, see borrow.
+}
+
+// layout returns the layout made by checkLayout,
+// every exported method calls checkLayout before it.
+func (x *XRS) layout() *layout {
+	return x.lay.Load().(*layout)
+}
+
+// checkLayout checks RS, XORSet and Substripes of x,
+// it only compares them with the last checked ones if nothing is changed.
+func (x *XRS) checkLayout() error {
+	l, _ := x.lay.Load().(*layout)
+	if l != nil && l.rs == x.RS && l.substripes == x.Substripes && equalXORSet(l.set, x.XORSet) {
+		return nil
+	}
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	err := checkSubstripes(p, x.substripes())
+	if err != nil {
+		return err
+	}
+	if p > 1 || len(x.XORSet) != 0 { // With one parity vector, XORSet is empty.
+		err = CheckXORSet(d, p, x.XORSet)
+		if err != nil {
+			return err
+		}
+	}
+	l = &layout{rs: x.RS, set: make(map[int][]int, len(x.XORSet)), substripes: x.Substripes}
+	for k, v := range x.XORSet {
+		l.set[k] = append([]int(nil), v...)
+	}
+	l.terms = make([][]term, p)
+	for i := range l.terms {
+		l.terms[i] = x.makeTerms(d + i)
+	}
+	l.bNeed = make([][]int, d)
+	for i := range l.bNeed {
+		l.bNeed[i] = x.makeBNeed(i)
+	}
+	x.lay.Store(l)
+	return nil
+}
+
+// checkSubstripes checks the number of sub-stripes with parityNum parity vectors.
+func checkSubstripes(parityNum, substripes int) error {
+	if substripes < 2 || (substripes > parityNum && !(parityNum == 1 && substripes == 2)) {
+		return fmt.Errorf("%w: %d", ErrIllegalSubstripes, substripes)
+	}
+	return nil
+}
+
+// borrow returns a Workspace of x from the pool in the layout,
+// it must be given back by release.
+func (x *XRS) borrow() (w *Workspace, err error) {
+	err = x.checkLayout()
+	if err != nil {
+		return
+	}
+	l := x.layout()
+	w, _ = l.pool.Get().(*Workspace)
+	if w == nil {
+		w = x.NewWorkspace()
+		w.pool = &l.pool
+	}
+	w.x = x
+	return
+}
+
+// release puts w back to the pool which it's borrowed from.
+func (w *Workspace) release() {
+	w.pool.Put(w)
+}
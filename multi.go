@@ -0,0 +1,389 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"fmt"
+	"sort"
+)
+
+// multiPlan is the plan of reconstructing lost data vectors.
+//
+// With piggyback:
+// 1. The last sub-stripe of lost data vectors is reconstructed by
+// Reed-Solomon from the other data vectors and helpers, which are parity
+// vectors without lost XOR terms (converted back to RS form by their terms).
+// RS form of the carriers is reconstructed at the same time.
+// 2. For each other sub-stripe s of lost data vector t, if the parity vector
+// e carrying it (the carrier) has no other lost XOR term:
+// a_t = vects[e] ⊕ rs(e) ⊕ other terms of e.
+// Otherwise (or if it's cheaper), sub-stripe s is reconstructed by
+// Reed-Solomon from DataNum vectors.
+//
+// Without piggyback, it's as same as Reconst with has as dpHas.
+type multiPlan struct {
+	data      []int    // Lost data vectors, ascending.
+	piggyback bool     // Use piggyback or not.
+	has       []int    // Vectors to read, ascending.
+	helpers   []int    // Parity vectors for reconstructing the last sub-stripe.
+	bHas      []int    // Vectors for reconstructing the last sub-stripe: other data vectors and helpers, ascending.
+	bNeed     []int    // Last sub-stripe to reconstruct: data, then RS form of carriers, ascending.
+	carriers  []int    // Parity vectors for reconstructing sub-stripes by XOR, ascending.
+	carried   []term   // carried[j] is the lost sub-stripe carried by carriers[j].
+	rsHas     [][]int  // rsHas[s] isn't nil if sub-stripe s is reconstructed by Reed-Solomon from them.
+	need      [][]bool // need[i][s] is true if sub-stripe s of vector i must be read.
+	cost      int      // Number of sub-stripes to read.
+}
+
+// GetNeedVectsMulti takes lost (indexes of all lost vectors, data or parity)
+// and returns:
+// 1) a-vector indexes
+// 2) b-vector indexes
+// required to reconstruct the lost data vectors by ReconstMulti.
+//
+// It's as same as GetNeedVects but for more than one lost data vector.
+// b-vectors are the vectors whose last sub-stripe is needed,
+// and a-vectors are the vectors whose other sub-stripes (some or all) are needed.
+//
+// When the lost data vectors are carried by different parity vectors,
+// the piggyback trick still reduces I/O; if it can't read less than
+// DataNum vectors, aNeed and bNeed are the same DataNum vectors
+// as Reed-Solomon needs.
+func (x *XRS) GetNeedVectsMulti(lost []int) (aNeed, bNeed []int, err error) {
+	pl, err := x.planMulti(lost)
+	if err != nil {
+		return
+	}
+	last := x.substripes() - 1
+	for _, i := range pl.has {
+		for s := 0; s < last; s++ {
+			if pl.need[i][s] {
+				aNeed = append(aNeed, i)
+				break
+			}
+		}
+		if pl.need[i][last] {
+			bNeed = append(bNeed, i)
+		}
+	}
+	return
+}
+
+// ReconstMulti reconstructs the lost data vectors with reduced I/O.
+// lost has indexes of all lost vectors (data or parity),
+// lost parity vectors are not reconstructed.
+// Ensure required vectors are available (see GetNeedVectsMulti).
+//
+// Vectors which are not lost are unmodified.
+func (x *XRS) ReconstMulti(vects [][]byte, lost []int) (err error) {
+
+	err = x.checkVects(vects)
+	if err != nil {
+		return
+	}
+	pl, err := x.planMulti(lost)
+	if err != nil {
+		return
+	}
+	w, err := x.borrow()
+	if err != nil {
+		return
+	}
+	defer w.release()
+	if !pl.piggyback {
+		return w.reconst(vects, pl.has, pl.data, true)
+	}
+	return w.reconstMulti(vects, pl)
+}
+
+// plan returns the plan for reconstructing the data vectors not in dpHas,
+// it's the plan without piggyback if planMulti fails.
+func (x *XRS) plan(dpHas []int) *multiPlan {
+	var key [4]uint64
+	for i := 0; i < x.RS.DataNum+x.RS.ParityNum; i++ {
+		if !isIn(i, dpHas) {
+			key[i>>6] |= 1 << uint(i&63)
+		}
+	}
+	v, ok := x.layout().plans.Load(key)
+	if ok {
+		return v.(*multiPlan)
+	}
+	pl, err := x.planMulti(x.lost(dpHas))
+	if err != nil {
+		pl = new(multiPlan)
+		x.layout().plans.Store(key, pl)
+	}
+	return pl
+}
+
+// planMulti returns the plan for reconstructing lost data vectors,
+// lost has indexes of all lost vectors.
+//
+// Plans are made on the first use of each lost pattern and kept in
+// the layout, don't modify them.
+func (x *XRS) planMulti(lost []int) (pl *multiPlan, err error) {
+
+	err = x.checkLayout()
+	if err != nil {
+		return
+	}
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	isLost := make([]bool, d+p)
+	var key [4]uint64
+	for _, i := range lost {
+		if i < 0 || i >= d+p {
+			return nil, fmt.Errorf("%w: %d in lost", ErrIllegalIndex, i)
+		}
+		if isLost[i] {
+			return nil, fmt.Errorf("%w: duplicated %d in lost", ErrIllegalIndex, i)
+		}
+		isLost[i] = true
+		key[i>>6] |= 1 << uint(i&63)
+	}
+	if len(lost) > p {
+		return nil, fmt.Errorf("%w: %d lost, %d at most", ErrTooFewShards, len(lost), p)
+	}
+	l := x.layout()
+	v, ok := l.plans.Load(key)
+	if ok {
+		return v.(*multiPlan), nil
+	}
+
+	pl, err = x.makePlan(isLost)
+	if err != nil {
+		return
+	}
+	l.plans.Store(key, pl)
+	return
+}
+
+// makePlan makes the plan of planMulti.
+func (x *XRS) makePlan(isLost []bool) (pl *multiPlan, err error) {
+
+	d := x.RS.DataNum
+	pl = new(multiPlan)
+	for i := 0; i < d; i++ {
+		if isLost[i] {
+			pl.data = append(pl.data, i)
+		}
+	}
+	if len(pl.data) == 0 {
+		return nil, fmt.Errorf("%w: no lost data", ErrIllegalIndex)
+	}
+
+	if x.planPiggyback(pl, isLost) && pl.cost < d*x.substripes() {
+		pl.piggyback = true
+	} else {
+		x.planRS(pl, isLost)
+	}
+	for i, subs := range pl.need {
+		for _, ok := range subs {
+			if ok {
+				pl.has = append(pl.has, i)
+				break
+			}
+		}
+	}
+	return
+}
+
+// planRS makes the plan of reading DataNum vectors:
+// available data vectors first, then parity vectors.
+func (x *XRS) planRS(pl *multiPlan, isLost []bool) {
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	pl.piggyback, pl.helpers, pl.bHas, pl.bNeed, pl.rsHas = false, nil, nil, nil, nil
+	pl.carriers, pl.carried = nil, nil
+	pl.need = makeNeed(d+p, x.substripes())
+	pl.cost = 0
+	for i := 0; i < d+p && pl.cost < d*x.substripes(); i++ {
+		if isLost[i] {
+			continue
+		}
+		for s := range pl.need[i] {
+			pl.need[i][s] = true
+			pl.cost++
+		}
+	}
+}
+
+// planPiggyback makes the plan with piggyback,
+// it returns false if it's impossible.
+func (x *XRS) planPiggyback(pl *multiPlan, isLost []bool) bool {
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	if p == 1 { // No XOR terms.
+		return false
+	}
+	last := x.substripes() - 1
+	need := makeNeed(d+p, x.substripes())
+	pl.need = need
+
+	// Step 1: Last sub-stripe.
+	for i := 0; i < d; i++ {
+		if !isLost[i] {
+			need[i][last] = true
+		}
+	}
+	type helper struct {
+		index, cost int
+	}
+	var hs []helper
+	if !isLost[d] {
+		hs = append(hs, helper{index: d, cost: 1})
+	}
+	for i := d + 1; i < d+p; i++ {
+		if isLost[i] {
+			continue
+		}
+		ts := x.terms(i)
+		clean := true
+		for _, t := range ts {
+			if isLost[t.index] {
+				clean = false
+				break
+			}
+		}
+		if clean {
+			hs = append(hs, helper{index: i, cost: 1 + len(ts)})
+		}
+	}
+	if len(hs) < len(pl.data) {
+		return false
+	}
+	sort.SliceStable(hs, func(i, j int) bool {
+		return hs[i].cost < hs[j].cost
+	})
+	for _, h := range hs[:len(pl.data)] {
+		pl.helpers = append(pl.helpers, h.index)
+		need[h.index][last] = true
+		for _, t := range x.terms(h.index) {
+			need[t.index][t.sub] = true
+		}
+	}
+	sort.Ints(pl.helpers)
+	for i := 0; i < d+p; i++ {
+		if (i < d && !isLost[i]) || isIn(i, pl.helpers) {
+			pl.bHas = append(pl.bHas, i)
+		}
+	}
+
+	// Step 2: Other sub-stripes, choose the cheaper way.
+	pl.rsHas = make([][]int, last)
+	for s := 0; s < last; s++ {
+		xorCost, ok := x.xorCost(need, isLost, pl.data, s)
+		rsHas, rsCost := x.rsHas(need, isLost, s)
+		if !ok || rsCost < xorCost {
+			pl.rsHas[s] = rsHas
+			for _, i := range rsHas {
+				need[i][s] = true
+			}
+			continue
+		}
+		for _, t := range pl.data {
+			e := x.carrier(t, s)
+			pl.carriers = append(pl.carriers, e)
+			pl.carried = append(pl.carried, term{index: t, sub: s})
+			need[e][last] = true
+			for _, tm := range x.terms(e) {
+				if tm.index != t {
+					need[tm.index][tm.sub] = true
+				}
+			}
+		}
+	}
+
+	sort.Sort(byCarrier{pl})
+	pl.bNeed = append(append([]int(nil), pl.data...), pl.carriers...)
+
+	pl.cost = 0
+	for _, subs := range need {
+		for _, ok := range subs {
+			if ok {
+				pl.cost++
+			}
+		}
+	}
+	return true
+}
+
+// carrier returns the parity vector which carries sub-stripe s of data vector t.
+func (x *XRS) carrier(t, s int) int {
+	key, _ := x.xorKey(t)
+	e, _ := x.slot(key, s)
+	return e
+}
+
+// xorCost returns the number of extra sub-stripes to read for
+// reconstructing sub-stripe s of lost data vectors by XOR,
+// it returns false if it's impossible.
+func (x *XRS) xorCost(need [][]bool, isLost []bool, data []int, s int) (cost int, ok bool) {
+	last := x.substripes() - 1
+	for _, t := range data {
+		e := x.carrier(t, s)
+		if isLost[e] {
+			return 0, false
+		}
+		if !need[e][last] {
+			cost++
+		}
+		for _, tm := range x.terms(e) {
+			if tm.index == t {
+				continue
+			}
+			if isLost[tm.index] { // Two unknowns in one equation.
+				return 0, false
+			}
+			if !need[tm.index][tm.sub] {
+				cost++
+			}
+		}
+	}
+	return cost, true
+}
+
+// rsHas returns DataNum available vectors for reconstructing sub-stripe s
+// by Reed-Solomon (the ones which will be read anyway first),
+// and the number of extra sub-stripes to read.
+func (x *XRS) rsHas(need [][]bool, isLost []bool, s int) (has []int, cost int) {
+	d := x.RS.DataNum
+	has = make([]int, 0, d)
+	for i := range need {
+		if len(has) < d && !isLost[i] && need[i][s] {
+			has = append(has, i)
+		}
+	}
+	for i := range need {
+		if len(has) < d && !isLost[i] && !need[i][s] {
+			has = append(has, i)
+			cost++
+		}
+	}
+	sort.Ints(has)
+	return
+}
+
+func makeNeed(n, substripes int) [][]bool {
+	need := make([][]bool, n)
+	for i := range need {
+		need[i] = make([]bool, substripes)
+	}
+	return need
+}
+
+// byCarrier sorts carriers and carried by carriers.
+type byCarrier struct {
+	pl *multiPlan
+}
+
+func (b byCarrier) Len() int { return len(b.pl.carriers) }
+
+func (b byCarrier) Less(i, j int) bool { return b.pl.carriers[i] < b.pl.carriers[j] }
+
+func (b byCarrier) Swap(i, j int) {
+	pl := b.pl
+	pl.carriers[i], pl.carriers[j] = pl.carriers[j], pl.carriers[i]
+	pl.carried[i], pl.carried[j] = pl.carried[j], pl.carried[i]
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestXRS_GetNeedVectsMulti(t *testing.T) {
+	cases := []struct {
+		d, p, substripes int
+		lost             []int
+		piggyback        bool
+	}{
+		{10, 6, 2, []int{0, 1}, true},
+		{10, 6, 2, []int{0, 1, 2}, false}, // Ties with RS.
+		{10, 8, 2, []int{0, 1, 2}, true},
+		{10, 6, 2, []int{0, 5}, false}, // Both are carried by 11.
+		{10, 6, 2, []int{0, 1, 12}, false},
+		{12, 4, 2, []int{0, 1}, false}, // As same as RS.
+		{12, 4, 2, []int{0}, true},
+		{20, 8, 3, []int{0, 1}, false}, // 22 carries both.
+		{20, 8, 3, []int{0, 2}, true},
+		{10, 1, 2, []int{0}, false},
+	}
+	for _, c := range cases {
+		x, err := NewWithSubstripes(c.d, c.p, c.substripes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pl, err := x.planMulti(c.lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pl.piggyback != c.piggyback {
+			t.Fatalf("%d+%d lost %v: piggyback mismatch, exp: %t", c.d, c.p, c.lost, c.piggyback)
+		}
+		if pl.piggyback && pl.cost >= c.d*c.substripes {
+			t.Fatalf("%d+%d lost %v: read %d sub-stripes, RS needs %d",
+				c.d, c.p, c.lost, pl.cost, c.d*c.substripes)
+		}
+
+		aNeed, bNeed, err := x.GetNeedVectsMulti(c.lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range append(aNeed, bNeed...) {
+			if isIn(i, c.lost) {
+				t.Fatalf("%d+%d lost %v: need lost vect %d", c.d, c.p, c.lost, i)
+			}
+		}
+		if !pl.piggyback && (len(aNeed) != c.d || fmt.Sprint(aNeed) != fmt.Sprint(bNeed)) {
+			t.Fatalf("%d+%d lost %v: RS should read %d vects: %v %v", c.d, c.p, c.lost, c.d, aNeed, bNeed)
+		}
+	}
+}
+
+func TestXRS_GetNeedVectsMultiIllegal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lost := range [][]int{nil, {d}, {-1}, {d + p}, {0, 0}, {0, 1, 2, 3, 4}} {
+		_, _, err = x.GetNeedVectsMulti(lost)
+		if err == nil {
+			t.Fatalf("lost %v should be illegal", lost)
+		}
+	}
+}
+
+// Only the sub-stripes in the plan are readable,
+// ReconstMulti, Reconst and Workspace.Reconst must get the lost data back with them.
+func TestXRS_ReconstMulti(t *testing.T) {
+	r := newTestRand(t)
+	cases := []struct {
+		d, p, substripes int
+	}{
+		{10, 6, 2},
+		{12, 4, 2},
+		{20, 8, 3},
+		{10, 8, 4},
+		{6, 3, 3},
+	}
+	for _, c := range cases {
+		x, err := NewWithSubstripes(c.d, c.p, c.substripes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := c.substripes * 64
+		exp := newShardMatrix(c.d+c.p, size)
+		for j := 0; j < c.d; j++ {
+			fillRandom(t, r, exp[j])
+		}
+		err = x.Encode(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := x.NewWorkspace()
+		fs := map[string]func([][]byte, []int, []int) error{
+			"XRS":                x.Reconst,
+			"Workspace":          w.Reconst,
+			"Workspace preserve": w.ReconstPreserveInputs,
+		}
+
+		for k := 0; k < 32; k++ {
+			lost := r.Perm(c.d + c.p)[:1+r.Intn(c.p)]
+			if !hasData(lost, c.d) {
+				lost = append(lost, r.Intn(c.d))
+				if len(lost) > c.p {
+					lost = lost[1:]
+				}
+			}
+			if !hasData(lost, c.d) {
+				continue
+			}
+			pl, err := x.planMulti(lost)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			act := newShardMatrix(c.d+c.p, size)
+			for i := range act {
+				for s := 0; s < c.substripes; s++ {
+					b := x.sub(act[i], s)
+					if pl.need[i][s] {
+						copy(b, x.sub(exp[i], s))
+						continue
+					}
+					for j := range b {
+						b[j] = 0xaa
+					}
+				}
+			}
+			orig := newShardMatrix(c.d+c.p, size)
+			for i := range act {
+				copy(orig[i], act[i])
+			}
+
+			err = x.ReconstMulti(act, lost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range act {
+				if isIn(i, pl.data) {
+					if !bytes.Equal(act[i], exp[i]) {
+						t.Fatalf("%d+%d (%d) lost %v: reconst failed: vect %d",
+							c.d, c.p, c.substripes, lost, i)
+					}
+				} else if !bytes.Equal(act[i], orig[i]) {
+					t.Fatalf("%d+%d (%d) lost %v: vect %d shouldn't be modified",
+						c.d, c.p, c.substripes, lost, i)
+				}
+			}
+
+			if !pl.piggyback || len(pl.data) < 2 {
+				continue
+			}
+			// Reconst takes the same path.
+			for name, f := range fs {
+				for i := range act {
+					copy(act[i], orig[i])
+				}
+				err = f(act, makeHasFromLost(c.d+c.p, lost), append([]int(nil), pl.data...))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, i := range pl.data {
+					if !bytes.Equal(act[i], exp[i]) {
+						t.Fatalf("%s: %d+%d (%d) lost %v: Reconst failed: vect %d",
+							name, c.d, c.p, c.substripes, lost, i)
+					}
+				}
+			}
+		}
+	}
+}
+
+func hasData(lost []int, d int) bool {
+	for _, i := range lost {
+		if i < d {
+			return true
+		}
+	}
+	return false
+}
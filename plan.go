@@ -0,0 +1,280 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import "fmt"
+
+// ReadRange is a byte range of a vector.
+type ReadRange struct {
+	Index  int // Index is the vector index in the whole stripe.
+	Offset int // Offset is the first byte of the range in the vector.
+	Length int // Length is the number of bytes.
+}
+
+// RepairPlan returns the byte ranges which must be read for reconstructing
+// vector lost (data or parity) with ReconstOne or ReconstParity.
+// vectSize is the size of each vector.
+//
+// Ranges are sorted by Index and Offset,
+// and adjacent ranges in the same vector are merged.
+// Bytes out of the ranges are never touched by the reconstruction.
+func (x *XRS) RepairPlan(lost, vectSize int) (plan []ReadRange, err error) {
+
+	if vectSize <= 0 {
+		err = fmt.Errorf("%w: %d", ErrOddVectSize, vectSize)
+		return
+	}
+	err = x.checkSize(vectSize)
+	if err != nil {
+		return
+	}
+
+	need, err := x.needSubs(lost)
+	if err != nil {
+		return
+	}
+
+	pl := Plan{Reads: readsOf(need), Substripes: x.substripes()}
+	return pl.Ranges(vectSize), nil
+}
+
+// needSubs returns which sub-stripes must be read for reconstructing
+// vector lost: need[i][s] is true if sub-stripe s of vector i is needed.
+func (x *XRS) needSubs(lost int) (need [][]bool, err error) {
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	need = make([][]bool, d+p)
+	for i := range need {
+		need[i] = make([]bool, x.substripes())
+	}
+
+	if lost >= d {
+		aNeed, bNeed, err2 := x.GetNeedVectsParity(lost)
+		if err2 != nil {
+			return nil, err2
+		}
+		last := x.substripes() - 1
+		for _, i := range aNeed {
+			for s := 0; s < last; s++ {
+				need[i][s] = true
+			}
+		}
+		for _, i := range bNeed {
+			need[i][last] = true
+		}
+		return
+	}
+
+	aNeed, bNeed, err := x.GetNeedVects(lost)
+	if err != nil {
+		return nil, err
+	}
+	last := x.substripes() - 1
+	if p == 1 { // No XOR terms, aNeed must be read entirely.
+		for _, i := range aNeed {
+			for s := 0; s < last; s++ {
+				need[i][s] = true
+			}
+		}
+	}
+	for i := 0; i < d; i++ {
+		if i != lost {
+			need[i][last] = true
+		}
+	}
+	for _, bi := range bNeed {
+		need[bi][last] = true
+	}
+	for _, bi := range bNeed[1:] {
+		for _, t := range x.terms(bi) {
+			if t.index != lost {
+				need[t.index][t.sub] = true
+			}
+		}
+	}
+	return
+}
+
+// Method is the way of reconstruction chosen by PlanReconst.
+type Method int
+
+// Methods of reconstruction.
+const (
+	// MethodReconst is Reed-Solomon: Reconst(vects, plan.Has, want),
+	// it reads DataNum vectors entirely.
+	MethodReconst Method = iota
+	// MethodReconstOne is ReconstOne(vects, want[0]).
+	MethodReconstOne
+	// MethodReconstParity is ReconstParity(vects, want[0]).
+	MethodReconstParity
+	// MethodReconstMulti is ReconstMulti(vects, lost),
+	// it reconstructs all the lost data vectors.
+	MethodReconstMulti
+)
+
+func (m Method) String() string {
+	switch m {
+	case MethodReconst:
+		return "Reconst"
+	case MethodReconstOne:
+		return "ReconstOne"
+	case MethodReconstParity:
+		return "ReconstParity"
+	case MethodReconstMulti:
+		return "ReconstMulti"
+	}
+	return fmt.Sprintf("Method(%d)", int(m))
+}
+
+// SubstripeRead is a sub-stripe of a vector which must be read.
+type SubstripeRead struct {
+	Index     int // Index is the vector index in the whole stripe.
+	Substripe int // Substripe is the sub-stripe index in the vector.
+}
+
+// Plan is the result of PlanReconst.
+type Plan struct {
+	// Method is the way of reconstruction.
+	Method Method
+	// Has are the vectors which must be available (the ones in Reads).
+	Has []int
+	// Reads are the sub-stripes to read, sorted by Index and Substripe.
+	Reads []SubstripeRead
+	// Substripes is the number of sub-stripes per vector.
+	Substripes int
+}
+
+// Bytes returns the number of bytes to read, vectSize is the size of each vector.
+func (pl Plan) Bytes(vectSize int) int {
+	return len(pl.Reads) * (vectSize / pl.Substripes)
+}
+
+// Ranges returns the byte ranges to read (see RepairPlan),
+// vectSize is the size of each vector.
+func (pl Plan) Ranges(vectSize int) (rs []ReadRange) {
+	n := vectSize / pl.Substripes
+	for _, r := range pl.Reads {
+		last := len(rs) - 1
+		if last >= 0 && rs[last].Index == r.Index && rs[last].Offset+rs[last].Length == r.Substripe*n {
+			rs[last].Length += n
+			continue
+		}
+		rs = append(rs, ReadRange{Index: r.Index, Offset: r.Substripe * n, Length: n})
+	}
+	return
+}
+
+// PlanReconst returns the plan which reads the fewest sub-stripes
+// for reconstructing want, lost are indexes of all lost vectors (data or parity)
+// and want must be a subset of lost.
+//
+// It compares ReconstOne and ReconstMulti (which save I/O by the XOR terms)
+// and ReconstParity (which reads all data vectors but no parity vector)
+// with Reed-Solomon (DataNum vectors),
+// the method in the result tells which one to call.
+func (x *XRS) PlanReconst(lost, want []int) (pl Plan, err error) {
+
+	err = x.checkLayout()
+	if err != nil {
+		return
+	}
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	isLost := make([]bool, d+p)
+	for _, i := range lost {
+		if i < 0 || i >= d+p {
+			err = fmt.Errorf("%w: %d in lost", ErrIllegalIndex, i)
+			return
+		}
+		if isLost[i] {
+			err = fmt.Errorf("%w: duplicated %d in lost", ErrIllegalIndex, i)
+			return
+		}
+		isLost[i] = true
+	}
+	if len(lost) > p {
+		err = fmt.Errorf("%w: %d lost, %d at most", ErrTooFewShards, len(lost), p)
+		return
+	}
+	if len(want) == 0 {
+		err = fmt.Errorf("%w: nothing wanted", ErrIllegalIndex)
+		return
+	}
+	allData := true
+	isWant := make([]bool, d+p)
+	for _, i := range want {
+		if i < 0 || i >= d+p || !isLost[i] {
+			err = fmt.Errorf("%w: %d in want isn't lost", ErrIllegalIndex, i)
+			return
+		}
+		if isWant[i] {
+			err = fmt.Errorf("%w: duplicated %d in want", ErrIllegalIndex, i)
+			return
+		}
+		isWant[i] = true
+		if i >= d {
+			allData = false
+		}
+	}
+
+	mp := &multiPlan{}
+	x.planRS(mp, isLost)
+	best, method := mp.need, MethodReconst
+	cost := mp.cost
+
+	try := func(need [][]bool, m Method) {
+		c := 0
+		for i, subs := range need {
+			for _, ok := range subs {
+				if !ok {
+					continue
+				}
+				if isLost[i] { // Unavailable.
+					return
+				}
+				c++
+			}
+		}
+		if c < cost || (c == cost && method == MethodReconst) {
+			best, method, cost = need, m, c
+		}
+	}
+	if len(want) == 1 {
+		need, err2 := x.needSubs(want[0])
+		if err2 == nil {
+			if want[0] < d {
+				try(need, MethodReconstOne)
+			} else {
+				try(need, MethodReconstParity)
+			}
+		}
+	}
+	if allData {
+		mp, err2 := x.planMulti(lost)
+		if err2 == nil && mp.piggyback {
+			try(mp.need, MethodReconstMulti)
+		}
+	}
+
+	pl = Plan{Method: method, Reads: readsOf(best), Substripes: x.substripes()}
+	for _, r := range pl.Reads {
+		if len(pl.Has) == 0 || pl.Has[len(pl.Has)-1] != r.Index {
+			pl.Has = append(pl.Has, r.Index)
+		}
+	}
+	return
+}
+
+// readsOf returns the sub-stripes in need.
+func readsOf(need [][]bool) (reads []SubstripeRead) {
+	for i, subs := range need {
+		for s, ok := range subs {
+			if ok {
+				reads = append(reads, SubstripeRead{Index: i, Substripe: s})
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestXRS_RepairPlan(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := sub * 64
+		exp := newShardMatrix(d+p, size)
+		for j := 0; j < d; j++ {
+			fillRandom(t, r, exp[j])
+		}
+		err = x.Encode(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for lost := 0; lost < d+p; lost++ {
+			plan, err := x.RepairPlan(lost, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			act := newShardMatrix(d+p, size)
+			total := 0
+			for j, rr := range plan {
+				if rr.Index == lost {
+					t.Fatal("plan should not read lost vect")
+				}
+				if j > 0 && plan[j-1].Index == rr.Index &&
+					plan[j-1].Offset+plan[j-1].Length >= rr.Offset {
+					t.Fatal("ranges should be sorted and merged", plan)
+				}
+				copy(act[rr.Index][rr.Offset:rr.Offset+rr.Length], exp[rr.Index][rr.Offset:rr.Offset+rr.Length])
+				total += rr.Length
+			}
+
+			if lost < d {
+				if total > d*size {
+					t.Fatalf("plan reads too much: %d", total)
+				}
+				if sub == 2 {
+					aNeed, _, err := x.GetNeedVects(lost)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if total != (d-1+2+len(aNeed))*size/2 {
+						t.Fatalf("mismatch plan size: %d", total)
+					}
+				}
+				err = x.ReconstOne(act, lost)
+			} else {
+				if total != d*size {
+					t.Fatalf("mismatch plan size: %d", total)
+				}
+				err = x.ReconstParity(act, lost)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(act[lost], exp[lost]) {
+				t.Fatalf("mismatch reconst by plan; vect: %d, substripes: %d", lost, sub)
+			}
+		}
+	}
+}
+
+func TestXRS_RepairPlanIllegal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	x, err := NewWithSubstripes(d, p, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, -3, 4} {
+		_, err = x.RepairPlan(0, size)
+		if err == nil {
+			t.Fatalf("vect size %d should be illegal", size)
+		}
+	}
+	for _, lost := range []int{-1, d + p} {
+		_, err = x.RepairPlan(lost, 3)
+		if err == nil {
+			t.Fatalf("index %d should be illegal", lost)
+		}
+	}
+}
+
+// Only the sub-stripes in the plan are readable,
+// the method in the plan must get want back with them.
+func TestXRS_PlanReconst(t *testing.T) {
+	r := newTestRand(t)
+	cases := []struct {
+		d, p, substripes int
+	}{
+		{12, 4, 2},
+		{10, 6, 2},
+		{10, 6, 3},
+		{6, 1, 2},
+	}
+	for _, c := range cases {
+		x, err := NewWithSubstripes(c.d, c.p, c.substripes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := c.d + c.p
+		size := c.substripes * 64
+		exp := newShardMatrix(n, size)
+		for j := 0; j < c.d; j++ {
+			fillRandom(t, r, exp[j])
+		}
+		err = x.Encode(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for k := 0; k < 64; k++ {
+			lost := r.Perm(n)[:1+r.Intn(c.p)]
+			want := lost[:1+r.Intn(len(lost))]
+			pl, err := x.PlanReconst(lost, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pl.Bytes(size) > c.d*size {
+				t.Fatalf("lost %v want %v: %s reads too much: %d", lost, want, pl.Method, pl.Bytes(size))
+			}
+			if len(want) == 1 && pl.Method == MethodReconst {
+				if _, err := x.RepairPlan(want[0], size); err == nil && !hasLost(x, want[0], lost, size) {
+					t.Fatalf("lost %v want %v: should use single vector reconstruction", lost, want)
+				}
+			}
+
+			act := newShardMatrix(n, size)
+			for _, rr := range pl.Ranges(size) {
+				if isIn(rr.Index, lost) {
+					t.Fatalf("lost %v want %v: plan reads lost vect %d", lost, want, rr.Index)
+				}
+				copy(act[rr.Index][rr.Offset:rr.Offset+rr.Length], exp[rr.Index][rr.Offset:rr.Offset+rr.Length])
+			}
+			switch pl.Method {
+			case MethodReconst:
+				err = x.Reconst(act, pl.Has, append([]int(nil), want...))
+			case MethodReconstOne:
+				err = x.ReconstOne(act, want[0])
+			case MethodReconstParity:
+				err = x.ReconstParity(act, want[0])
+			case MethodReconstMulti:
+				err = x.ReconstMulti(act, lost)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range want {
+				if !bytes.Equal(act[i], exp[i]) {
+					t.Fatalf("lost %v want %v: %s failed: vect %d", lost, want, pl.Method, i)
+				}
+			}
+		}
+	}
+}
+
+// hasLost returns true if the repair plan of i reads a lost vector.
+func hasLost(x *XRS, i int, lost []int, size int) bool {
+	plan, _ := x.RepairPlan(i, size)
+	for _, rr := range plan {
+		if isIn(rr.Index, lost) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestXRS_PlanReconstIllegal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		lost, want []int
+	}{
+		{[]int{0}, nil},
+		{[]int{0}, []int{1}},
+		{[]int{0, 0}, []int{0}},
+		{[]int{-1}, []int{-1}},
+		{[]int{0, 1}, []int{0, 0}},
+		{[]int{0, 1, 2, 3, 4}, []int{0}},
+	}
+	for _, c := range cases {
+		_, err = x.PlanReconst(c.lost, c.want)
+		if err == nil {
+			t.Fatalf("lost %v want %v should be illegal", c.lost, c.want)
+		}
+	}
+}
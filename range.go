@@ -0,0 +1,330 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"fmt"
+	"sort"
+
+	xor "github.com/templexxx/xorsimd"
+)
+
+// XRS operations are byte-wise across vectors: byte i of a sub-stripe
+// only depends on byte i of sub-stripes of other vectors.
+// So a byte range of a vector is mapped onto an interval of each sub-stripe
+// it covers, and only the same intervals of other vectors are involved.
+
+// subRange is the interval [lo, hi) of sub-stripe s.
+type subRange struct {
+	s, lo, hi int
+}
+
+// subRanges maps bytes [off, off+n) of a vector onto its sub-stripes,
+// size is the size of the vector.
+func (x *XRS) subRanges(size, off, n int) []subRange {
+	if n == 0 {
+		return nil
+	}
+	sn := size / x.substripes()
+	var rs []subRange
+	for s := off / sn; s < x.substripes() && s*sn < off+n; s++ {
+		lo, hi := off-s*sn, off+n-s*sn
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > sn {
+			hi = sn
+		}
+		rs = append(rs, subRange{s: s, lo: lo, hi: hi})
+	}
+	return rs
+}
+
+// checkRange checks bytes [off, off+n) of a vector with size bytes.
+func checkRange(size, off, n int) error {
+	if off < 0 || n < 0 || off+n > size {
+		return fmt.Errorf("%w: range [%d, %d) out of vect size %d", ErrIllegalIndex, off, off+n, size)
+	}
+	return nil
+}
+
+// RepairPlanRange is as same as RepairPlan, but it returns the byte ranges
+// which must be read for reconstructing bytes [off, off+n) of data vector lost
+// with ReconstRange.
+func (x *XRS) RepairPlanRange(lost, vectSize, off, n int) (plan []ReadRange, err error) {
+
+	if vectSize <= 0 {
+		err = fmt.Errorf("%w: %d", ErrOddVectSize, vectSize)
+		return
+	}
+	err = x.checkSize(vectSize)
+	if err != nil {
+		return
+	}
+	err = x.checkDataIndex(lost)
+	if err != nil {
+		return
+	}
+	err = checkRange(vectSize, off, n)
+	if err != nil {
+		return
+	}
+	err = x.checkLayout()
+	if err != nil {
+		return
+	}
+
+	sn := vectSize / x.substripes()
+	var rs []ReadRange
+	add := func(i, s, lo, hi int) {
+		rs = append(rs, ReadRange{Index: i, Offset: s*sn + lo, Length: hi - lo})
+	}
+	d, last := x.RS.DataNum, x.substripes()-1
+	for _, r := range x.subRanges(vectSize, off, n) {
+		s := r.s
+		if s < last && x.RS.ParityNum > 1 {
+			s = last
+			e := x.carrier(lost, r.s)
+			add(e, last, r.lo, r.hi)
+			for _, t := range x.terms(e) {
+				if t.index != lost {
+					add(t.index, t.sub, r.lo, r.hi)
+				}
+			}
+		}
+		for i := 0; i <= d; i++ {
+			if i != lost {
+				add(i, s, r.lo, r.hi)
+			}
+		}
+	}
+
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Index != rs[j].Index {
+			return rs[i].Index < rs[j].Index
+		}
+		return rs[i].Offset < rs[j].Offset
+	})
+	for _, r := range rs {
+		k := len(plan) - 1
+		if k >= 0 && plan[k].Index == r.Index && plan[k].Offset+plan[k].Length >= r.Offset {
+			if end := r.Offset + r.Length; end > plan[k].Offset+plan[k].Length {
+				plan[k].Length = end - plan[k].Offset
+			}
+			continue
+		}
+		plan = append(plan, r)
+	}
+	return
+}
+
+// ReconstRange reconstructs bytes [off, off+n) of data vector lost
+// and writes them into vects[lost][off:off+n],
+// other bytes of vects[lost] are untouched.
+// Only the ranges returned by RepairPlanRange are read.
+func (x *XRS) ReconstRange(vects [][]byte, lost, off, n int) (err error) {
+
+	err = x.checkVects(vects)
+	if err != nil {
+		return
+	}
+	err = x.checkDataIndex(lost)
+	if err != nil {
+		return
+	}
+	size := len(vects[0])
+	err = checkRange(size, off, n)
+	if err != nil {
+		return
+	}
+
+	w, err := x.borrow()
+	if err != nil {
+		return
+	}
+	defer w.release()
+
+	d := x.RS.DataNum
+	has := make([]int, d)
+	for i := range has {
+		has[i] = i
+	}
+	has[lost] = d // Replace lost with DataNum.
+
+	last := x.substripes() - 1
+	sv := make([][]byte, len(vects))
+	for _, r := range x.subRanges(size, off, n) {
+		dst := x.sub(vects[lost], r.s)[r.lo:r.hi]
+		if r.s == last || x.RS.ParityNum == 1 {
+			// The same sub-stripe of DataNum and other data vectors is RS codes.
+			for i, v := range vects {
+				sv[i] = x.sub(v, r.s)[r.lo:r.hi]
+			}
+			sv[lost] = dst
+			err = w.decode(sv, has, []int{lost})
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		// ∵ a_lost ⊕ other terms ⊕ rs(e) = vects[e]
+		// ∴ a_lost = vects[e] ⊕ rs(e) ⊕ other terms
+		e := x.carrier(lost, r.s)
+		for i, v := range vects {
+			sv[i] = x.sub(v, last)[r.lo:r.hi]
+		}
+		rse := make([]byte, r.hi-r.lo)
+		sv[e] = rse
+		err = w.decode(sv, has, []int{e})
+		if err != nil {
+			return
+		}
+		xv := [][]byte{x.sub(vects[e], last)[r.lo:r.hi], rse}
+		for _, t := range x.terms(e) {
+			if t.index != lost {
+				xv = append(xv, x.sub(vects[t.index], t.sub)[r.lo:r.hi])
+			}
+		}
+		xor.Encode(dst, xv)
+	}
+	return
+}
+
+// EncodeRange is as same as Encode, but only bytes [off, off+n) of
+// the data vectors have changed since the last encoding,
+// so only the parity bytes depending on them are recomputed.
+//
+// Sub-stripe s (except the last) of data vectors is XOR-ed into
+// the last sub-stripe of parity vectors at the same offset,
+// so bytes in it also affect the last sub-stripe of parity vectors.
+func (x *XRS) EncodeRange(vects [][]byte, off, n int) (err error) {
+
+	err = x.checkVects(vects)
+	if err != nil {
+		return
+	}
+	err = checkRange(len(vects[0]), off, n)
+	if err != nil {
+		return
+	}
+
+	// Step 1: Other sub-stripes, RS.
+	last := x.substripes() - 1
+	var lasts []subRange
+	for _, r := range x.subRanges(len(vects[0]), off, n) {
+		if r.s == last || x.RS.ParityNum > 1 {
+			lasts = append(lasts, subRange{s: last, lo: r.lo, hi: r.hi})
+		}
+		if r.s == last {
+			continue
+		}
+		err = x.encodeSub(vects, r)
+		if err != nil {
+			return
+		}
+	}
+
+	// Step 2: Last sub-stripe, RS then XOR based on XORSet.
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	for _, r := range mergeSubRanges(lasts) {
+		err = x.encodeSub(vects, r)
+		if err != nil {
+			return
+		}
+		for i := d + 1; i < d+p; i++ {
+			x.xorTermsInto(x.sub(vects[i], last)[r.lo:r.hi], vects, i, r.lo)
+		}
+	}
+	return
+}
+
+// encodeSub encodes bytes [r.lo, r.hi) of sub-stripe r.s using Reed-Solomon.
+func (x *XRS) encodeSub(vects [][]byte, r subRange) error {
+	tmp := make([][]byte, len(vects))
+	for i, v := range vects {
+		tmp[i] = x.sub(v, r.s)[r.lo:r.hi]
+	}
+	return wrapRS(x.RS.Encode(tmp))
+}
+
+// mergeSubRanges merges overlapping intervals of the same sub-stripe.
+func mergeSubRanges(rs []subRange) (merged []subRange) {
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].s != rs[j].s {
+			return rs[i].s < rs[j].s
+		}
+		return rs[i].lo < rs[j].lo
+	})
+	for _, r := range rs {
+		k := len(merged) - 1
+		if k >= 0 && merged[k].s == r.s && merged[k].hi >= r.lo {
+			if r.hi > merged[k].hi {
+				merged[k].hi = r.hi
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return
+}
+
+// UpdateRange is as same as Update, but only bytes [off, off+len(newData))
+// of data vector row have changed: oldData and newData are the old and new bytes
+// of the range, and parity are the whole parity vectors.
+// Only the parity bytes depending on the range are updated.
+func (x *XRS) UpdateRange(oldData, newData []byte, row, off int, parity [][]byte) (err error) {
+
+	if len(parity) != x.RS.ParityNum {
+		return fmt.Errorf("%w: %d parity vects, want %d", ErrIllegalParity, len(parity), x.RS.ParityNum)
+	}
+	size := len(parity[0])
+	if size == 0 {
+		return fmt.Errorf("%w: %d", ErrOddVectSize, size)
+	}
+	err = x.checkSize(size)
+	if err != nil {
+		return
+	}
+	err = x.checkParity(parity, size)
+	if err != nil {
+		return
+	}
+	if len(newData) != len(oldData) {
+		return fmt.Errorf("%w: new data has %d bytes, want %d", ErrShardSizeMismatch, len(newData), len(oldData))
+	}
+	err = x.checkDataIndex(row)
+	if err != nil {
+		return
+	}
+	err = checkRange(size, off, len(oldData))
+	if err != nil {
+		return
+	}
+
+	sn := size / x.substripes()
+	last := x.substripes() - 1
+	ps := make([][]byte, len(parity))
+	src := make([][]byte, 3)
+	for _, r := range x.subRanges(size, off, len(oldData)) {
+		lo := r.s*sn + r.lo - off
+		o, nd := oldData[lo:lo+r.hi-r.lo], newData[lo:lo+r.hi-r.lo]
+		for i, v := range parity {
+			ps[i] = x.sub(v, r.s)[r.lo:r.hi]
+		}
+		err = x.RS.Update(o, nd, row, ps)
+		if err != nil {
+			return wrapRS(err)
+		}
+		if r.s == last || x.RS.ParityNum == 1 {
+			continue
+		}
+		bv := x.sub(parity[x.carrier(row, r.s)-x.RS.DataNum], last)[r.lo:r.hi]
+		src[0], src[1], src[2] = o, nd, bv
+		xor.Encode(bv, src)
+	}
+	return
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestXRS_ReconstRange(t *testing.T) {
+	r := newTestRand(t)
+	cases := []struct {
+		d, p, substripes int
+	}{
+		{12, 4, 2},
+		{10, 6, 3},
+		{6, 1, 2},
+	}
+	for _, c := range cases {
+		x, err := NewWithSubstripes(c.d, c.p, c.substripes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := c.substripes * 100
+		exp := newShardMatrix(c.d+c.p, size)
+		for j := 0; j < c.d; j++ {
+			fillRandom(t, r, exp[j])
+		}
+		err = x.Encode(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for lost := 0; lost < c.d; lost++ {
+			// The whole vector is as same as RepairPlan.
+			plan, err := x.RepairPlanRange(lost, size, 0, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan2, err := x.RepairPlan(lost, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(plan) != fmt.Sprint(plan2) {
+				t.Fatalf("lost %d: mismatch whole range plan: %v, exp: %v", lost, plan, plan2)
+			}
+
+			for k := 0; k < 8; k++ {
+				off := r.Intn(size)
+				n := r.Intn(size - off + 1)
+				plan, err := x.RepairPlanRange(lost, size, off, n)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				act := newShardMatrix(c.d+c.p, size)
+				for i := range act {
+					for j := range act[i] {
+						act[i][j] = 0xaa
+					}
+				}
+				for _, rr := range plan {
+					if rr.Index == lost {
+						t.Fatal("plan should not read lost vect")
+					}
+					copy(act[rr.Index][rr.Offset:rr.Offset+rr.Length], exp[rr.Index][rr.Offset:rr.Offset+rr.Length])
+				}
+				err = x.ReconstRange(act, lost, off, n)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(act[lost][off:off+n], exp[lost][off:off+n]) {
+					t.Fatalf("%d+%d (%d) lost %d: mismatch range [%d, %d)",
+						c.d, c.p, c.substripes, lost, off, off+n)
+				}
+				for j, b := range act[lost] {
+					if (j < off || j >= off+n) && b != 0xaa {
+						t.Fatalf("%d+%d (%d) lost %d: byte %d out of range [%d, %d) is touched",
+							c.d, c.p, c.substripes, lost, j, off, off+n)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestXRS_ReconstRangeIllegal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vects := newShardMatrix(d+p, 64)
+	cases := []struct {
+		lost, off, n int
+	}{
+		{d, 0, 1},
+		{-1, 0, 1},
+		{0, -1, 1},
+		{0, 0, -1},
+		{0, 60, 5},
+	}
+	for _, c := range cases {
+		err = x.ReconstRange(vects, c.lost, c.off, c.n)
+		if err == nil {
+			t.Fatalf("lost %d range [%d, %d) should be illegal", c.lost, c.off, c.off+c.n)
+		}
+		_, err = x.RepairPlanRange(c.lost, 64, c.off, c.n)
+		if err == nil {
+			t.Fatalf("plan: lost %d range [%d, %d) should be illegal", c.lost, c.off, c.off+c.n)
+		}
+	}
+	err = x.ReconstRange(vects, 0, 64, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestXRS_EncodeUpdateRange(t *testing.T) {
+	r := newTestRand(t)
+	cases := []struct {
+		d, p, substripes int
+	}{
+		{12, 4, 2},
+		{10, 6, 3},
+		{6, 1, 2},
+	}
+	for _, c := range cases {
+		x, err := NewWithSubstripes(c.d, c.p, c.substripes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := c.substripes * 100
+		act := newShardMatrix(c.d+c.p, size)
+		for j := 0; j < c.d; j++ {
+			fillRandom(t, r, act[j])
+		}
+		err = x.Encode(act)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := newShardMatrix(c.d+c.p, size)
+
+		for k := 0; k < 32; k++ {
+			off := r.Intn(size)
+			n := r.Intn(size - off + 1)
+			row := r.Intn(c.d)
+			old := make([]byte, n)
+			copy(old, act[row][off:off+n])
+			fillRandom(t, r, act[row][off:off+n])
+
+			if k%2 == 0 {
+				err = x.UpdateRange(old, act[row][off:off+n], row, off, act[c.d:])
+			} else {
+				fillRandom(t, r, act[(row+1)%c.d][off:off+n])
+				err = x.EncodeRange(act, off, n)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range act {
+				copy(exp[i], act[i])
+			}
+			err = x.Encode(exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := c.d; i < c.d+c.p; i++ {
+				if !bytes.Equal(act[i], exp[i]) {
+					t.Fatalf("%d+%d (%d): mismatch parity %d after range [%d, %d) of %d changed",
+						c.d, c.p, c.substripes, i, off, off+n, row)
+				}
+			}
+		}
+	}
+}
+
+func TestXRS_EncodeUpdateRangeIllegal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vects := newShardMatrix(d+p, 64)
+	if err = x.EncodeRange(vects, 60, 5); err == nil {
+		t.Fatal("range out of vect should be illegal")
+	}
+	if err = x.EncodeRange(vects[:d], 0, 1); err == nil {
+		t.Fatal("vects number should be illegal")
+	}
+	cases := []struct {
+		old, new []byte
+		row, off int
+		parity   [][]byte
+	}{
+		{make([]byte, 4), make([]byte, 4), 0, 0, vects[d+1:]},
+		{make([]byte, 4), make([]byte, 3), 0, 0, vects[d:]},
+		{make([]byte, 4), make([]byte, 4), d, 0, vects[d:]},
+		{make([]byte, 4), make([]byte, 4), 0, 62, vects[d:]},
+		{make([]byte, 4), make([]byte, 4), 0, 0, newShardMatrix(p, 3)},
+	}
+	for i, c := range cases {
+		err = x.UpdateRange(c.old, c.new, c.row, c.off, c.parity)
+		if err == nil {
+			t.Fatalf("case %d should be illegal", i)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"fmt"
+	"io"
+)
+
+// Split splits data into DataNum data vectors, and makes ParityNum empty
+// parity vectors (Encode them later). data is copied.
+//
+// The vector size is the smallest multiple of Substripes which can hold data,
+// the tail is padded with zeros, so the caller should keep len(data) for Join.
+func (x *XRS) Split(data []byte) (vects [][]byte, err error) {
+	return x.SplitAlign(data, 1)
+}
+
+// SplitAlign is as same as Split,
+// but the vector size is also rounded up to a multiple of align
+// (e.g., 4096 for direct I/O).
+func (x *XRS) SplitAlign(data []byte, align int) (vects [][]byte, err error) {
+
+	if len(data) == 0 {
+		err = fmt.Errorf("%w: empty data", ErrOddVectSize)
+		return
+	}
+	if align <= 0 {
+		err = fmt.Errorf("%w: illegal align: %d", ErrOddVectSize, align)
+		return
+	}
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	unit := lcm(x.substripes(), align)
+	size := (len(data) + d - 1) / d
+	size = (size + unit - 1) / unit * unit
+
+	buf := make([]byte, (d+p)*size)
+	copy(buf, data)
+	vects = make([][]byte, d+p)
+	for i := range vects {
+		vects[i] = buf[i*size : i*size+size]
+	}
+	return
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a, b int) int {
+	return a / gcd(a, b) * b
+}
+
+// Join writes the first outSize bytes of data vectors into dst,
+// it's the reverse of Split.
+//
+// Missing vectors should be nil (or empty). If there is any missing data
+// vector, it's reconstructed on the fly (at most ParityNum vectors could be
+// missing). vects is not modified.
+func (x *XRS) Join(dst io.Writer, vects [][]byte, outSize int) (err error) {
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	if len(vects) != d+p {
+		return fmt.Errorf("%w: %d vects, want %d", ErrTooFewShards, len(vects), d+p)
+	}
+	if outSize < 0 {
+		return fmt.Errorf("%w: illegal out size: %d", ErrShardSizeMismatch, outSize)
+	}
+
+	size := 0
+	var dpHas, lost []int
+	for i, v := range vects {
+		if len(v) == 0 {
+			if i < d {
+				lost = append(lost, i)
+			}
+			continue
+		}
+		if size != 0 && len(v) != size {
+			return fmt.Errorf("%w: vect %d has %d bytes, want %d", ErrShardSizeMismatch, i, len(v), size)
+		}
+		size = len(v)
+		dpHas = append(dpHas, i)
+	}
+	if outSize > d*size {
+		return fmt.Errorf("%w: out size too big: %d > %d", ErrShardSizeMismatch, outSize, d*size)
+	}
+
+	if len(lost) != 0 {
+		if len(dpHas) < d {
+			return fmt.Errorf("%w: %d vects, need %d at least", ErrTooFewShards, len(dpHas), d)
+		}
+		// Reconst converts parity vectors (except DataNum) to RS form
+		// in place, so they're copied.
+		rv := make([][]byte, d+p)
+		for i, v := range vects {
+			if len(v) == 0 {
+				v = make([]byte, size)
+			} else if i > d {
+				v = append([]byte(nil), v...)
+			}
+			rv[i] = v
+		}
+		err = x.Reconst(rv, dpHas, lost)
+		if err != nil {
+			return
+		}
+		vects = rv
+	}
+
+	for i := 0; i < d && outSize > 0; i++ {
+		v := vects[i]
+		if outSize < len(v) {
+			v = v[:outSize]
+		}
+		_, err = dst.Write(v)
+		if err != nil {
+			return
+		}
+		outSize -= len(v)
+	}
+	return
+}
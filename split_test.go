@@ -0,0 +1,164 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestXRS_SplitJoin(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, align := range []int{1, 2, 16, 4096} {
+			for _, size := range []int{1, d*sub - 1, d * sub, 1000} {
+				data := make([]byte, size)
+				fillRandom(t, r, data)
+
+				vects, err := x.SplitAlign(data, align)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(vects) != d+p {
+					t.Fatal("mismatch vects number")
+				}
+				vs := len(vects[0])
+				if vs%sub != 0 || vs%align != 0 || vs*d < size {
+					t.Fatalf("illegal vect size: %d; substripes: %d, align: %d", vs, sub, align)
+				}
+				err = x.Encode(vects)
+				if err != nil {
+					t.Fatal(err)
+				}
+				bak := newShardMatrix(d+p, vs)
+				for i := range vects {
+					copy(bak[i], vects[i])
+				}
+
+				buf := new(bytes.Buffer)
+				err = x.Join(buf, vects, size)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf.Bytes(), data) {
+					t.Fatal("mismatch join")
+				}
+
+				// Degraded join.
+				lost := makeLostRandom(r, d+p, r.Intn(p)+1)
+				lv := make([][]byte, d+p)
+				copy(lv, vects)
+				for _, l := range lost {
+					lv[l] = nil
+				}
+				buf.Reset()
+				err = x.Join(buf, lv, size)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf.Bytes(), data) {
+					t.Fatalf("mismatch degraded join, lost: %v", lost)
+				}
+				for i := range vects {
+					if !bytes.Equal(bak[i], vects[i]) {
+						t.Fatal("join should not modify vects")
+					}
+				}
+			}
+		}
+	}
+}
+
+// Join must not write vects even for a moment,
+// so concurrent Joins could share the same vects.
+func TestXRS_JoinConcurrent(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, d*256*1024)
+	fillRandom(t, r, data)
+	vects, err := x.Split(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = x.Encode(vects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reconst converts the parity vectors in dpHas back to RS form
+	// for reconstructing 0 and 3.
+	vects[0], vects[3] = nil, nil
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 16; k++ {
+				buf := new(bytes.Buffer)
+				err2 := x.Join(buf, vects, len(data))
+				if err2 == nil && !bytes.Equal(buf.Bytes(), data) {
+					err2 = errors.New("mismatch concurrent join")
+				}
+				if err2 != nil {
+					errs <- err2
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err = range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestXRS_SplitJoinIllegal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = x.Split(nil)
+	if err == nil {
+		t.Fatal("should return error for empty data")
+	}
+	_, err = x.SplitAlign([]byte{1}, 0)
+	if err == nil {
+		t.Fatal("should return error for illegal align")
+	}
+
+	vects, err := x.Split(make([]byte, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = x.Join(new(bytes.Buffer), vects, d*len(vects[0])+1)
+	if err == nil {
+		t.Fatal("should return error for too big out size")
+	}
+	for i := 0; i <= p; i++ {
+		vects[i] = nil
+	}
+	err = x.Join(new(bytes.Buffer), vects, 100)
+	if err == nil {
+		t.Fatal("should return error for too many lost")
+	}
+}
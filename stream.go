@@ -0,0 +1,154 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"fmt"
+	"io"
+)
+
+// StreamEncoder encodes a stream stripe by stripe,
+// so only one stripe is held in memory.
+//
+// Each stripe has DataNum+ParityNum vectors of vectSize bytes,
+// and shard i is the concatenation of vector i of every stripe.
+//
+// A StreamEncoder must not be used concurrently.
+type StreamEncoder struct {
+	x        *XRS
+	w        *Workspace
+	vectSize int
+	vects    [][]byte
+}
+
+// NewStreamEncoder makes a StreamEncoder with the given vector size.
+func (x *XRS) NewStreamEncoder(vectSize int) (e *StreamEncoder, err error) {
+
+	if vectSize <= 0 {
+		err = fmt.Errorf("%w: %d", ErrOddVectSize, vectSize)
+		return
+	}
+	err = x.checkSize(vectSize)
+	if err != nil {
+		return
+	}
+
+	n := x.RS.DataNum + x.RS.ParityNum
+	buf := make([]byte, n*vectSize)
+	vects := make([][]byte, n)
+	for i := range vects {
+		vects[i] = buf[i*vectSize : i*vectSize+vectSize]
+	}
+	e = &StreamEncoder{x: x, w: x.NewWorkspace(), vectSize: vectSize, vects: vects}
+	return
+}
+
+// Encode reads r until io.EOF and writes shard i into shards[i],
+// len(shards) must be DataNum+ParityNum.
+// It returns the number of bytes read from r.
+//
+// The last stripe is padded with zeros,
+// so the caller should keep the size of stream for restoring it.
+// An empty stream makes no stripe.
+func (e *StreamEncoder) Encode(r io.Reader, shards []io.Writer) (n int64, err error) {
+
+	d, p := e.x.RS.DataNum, e.x.RS.ParityNum
+	if len(shards) != d+p {
+		err = fmt.Errorf("%w: %d shards, want %d", ErrTooFewShards, len(shards), d+p)
+		return
+	}
+
+	data := e.vects[0][:d*e.vectSize] // Data vectors are contiguous.
+	for {
+		m, err2 := io.ReadFull(r, data)
+		n += int64(m)
+		if err2 == io.EOF {
+			return
+		}
+		if err2 != nil && err2 != io.ErrUnexpectedEOF {
+			return n, err2
+		}
+		for i := m; i < len(data); i++ {
+			data[i] = 0
+		}
+
+		err = e.w.Encode(e.vects)
+		if err != nil {
+			return
+		}
+		for i, w := range shards {
+			_, err = w.Write(e.vects[i])
+			if err != nil {
+				return
+			}
+		}
+
+		if err2 == io.ErrUnexpectedEOF {
+			return
+		}
+	}
+}
+
+// StreamRepair reconstructs shard lost (data or parity) stripe by stripe,
+// and writes it into dst. Shards are made by StreamEncoder with vectSize.
+//
+// For each stripe only the byte ranges in RepairPlan are read from sources,
+// sources[i] is shard i. Sources which are not in the plan (including
+// sources[lost]) are never touched, they could be nil.
+// All shards must have the same size, which is a multiple of vectSize.
+func (x *XRS) StreamRepair(lost int, sources []io.ReaderAt, dst io.Writer, vectSize int) (err error) {
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	if len(sources) != d+p {
+		return fmt.Errorf("%w: %d sources, want %d", ErrTooFewShards, len(sources), d+p)
+	}
+	plan, err := x.RepairPlan(lost, vectSize)
+	if err != nil {
+		return
+	}
+	for _, rr := range plan {
+		if sources[rr.Index] == nil {
+			return fmt.Errorf("%w: missing source: %d", ErrTooFewShards, rr.Index)
+		}
+	}
+
+	buf := make([]byte, (d+p)*vectSize)
+	vects := make([][]byte, d+p)
+	for i := range vects {
+		vects[i] = buf[i*vectSize : i*vectSize+vectSize]
+	}
+	w := x.NewWorkspace()
+
+	for off := int64(0); ; off += int64(vectSize) {
+		for j, rr := range plan {
+			b := vects[rr.Index][rr.Offset : rr.Offset+rr.Length]
+			n, err2 := sources[rr.Index].ReadAt(b, off+int64(rr.Offset))
+			if n == len(b) {
+				continue
+			}
+			if j == 0 && n == 0 && err2 == io.EOF {
+				return nil // All stripes are done.
+			}
+			if err2 == nil || err2 == io.EOF {
+				err2 = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("failed to read vect %d at %d: %w", rr.Index, off+int64(rr.Offset), err2)
+		}
+
+		if lost < d {
+			err = w.ReconstOne(vects, lost)
+		} else {
+			err = w.ReconstParity(vects, lost)
+		}
+		if err != nil {
+			return
+		}
+		_, err = dst.Write(vects[lost])
+		if err != nil {
+			return
+		}
+	}
+}
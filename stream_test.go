@@ -0,0 +1,186 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestStreamEncoder_Encode(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vectSize := sub * 16
+		e, err := x.NewStreamEncoder(vectSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stripeSize := d * vectSize
+		for _, size := range []int{0, 1, stripeSize - 1, stripeSize, 3*stripeSize + 5} {
+			data := make([]byte, size)
+			fillRandom(t, r, data)
+
+			bufs := make([]*bytes.Buffer, d+p)
+			shards := make([]io.Writer, d+p)
+			for i := range shards {
+				bufs[i] = new(bytes.Buffer)
+				shards[i] = bufs[i]
+			}
+			n, err := e.Encode(bytes.NewReader(data), shards)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(size) {
+				t.Fatalf("mismatch read size: %d, exp: %d", n, size)
+			}
+
+			stripes := (size + stripeSize - 1) / stripeSize
+			for i := range bufs {
+				if bufs[i].Len() != stripes*vectSize {
+					t.Fatalf("mismatch shard size: %d", bufs[i].Len())
+				}
+			}
+			for s := 0; s < stripes; s++ {
+				exp := newShardMatrix(d+p, vectSize)
+				for i := 0; i < d; i++ {
+					off := s*stripeSize + i*vectSize
+					if off < size {
+						copy(exp[i], data[off:])
+					}
+				}
+				err = x.Encode(exp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := range exp {
+					act := bufs[i].Bytes()[s*vectSize : s*vectSize+vectSize]
+					if !bytes.Equal(exp[i], act) {
+						t.Fatalf("mismatch stripe %d, vect: %d, size: %d", s, i, size)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNewStreamEncoderIllegal(t *testing.T) {
+	x, err := NewWithSubstripes(testDataShards, testParityShards, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, -3, 4} {
+		_, err = x.NewStreamEncoder(size)
+		if err == nil {
+			t.Fatalf("vect size %d should be illegal", size)
+		}
+	}
+	e, err := x.NewStreamEncoder(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.Encode(bytes.NewReader(nil), make([]io.Writer, 1))
+	if err == nil {
+		t.Fatal("should return error for illegal shards number")
+	}
+}
+
+// countReaderAt counts bytes read.
+type countReaderAt struct {
+	r io.ReaderAt
+	n int
+}
+
+func (c *countReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	n, err = c.r.ReadAt(p, off)
+	c.n += n
+	return
+}
+
+func TestXRS_StreamRepair(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vectSize := sub * 16
+		e, err := x.NewStreamEncoder(vectSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stripes := 5
+		data := make([]byte, stripes*d*vectSize-7)
+		fillRandom(t, r, data)
+		bufs := make([]*bytes.Buffer, d+p)
+		shards := make([]io.Writer, d+p)
+		for i := range shards {
+			bufs[i] = new(bytes.Buffer)
+			shards[i] = bufs[i]
+		}
+		_, err = e.Encode(bytes.NewReader(data), shards)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for lost := 0; lost < d+p; lost++ {
+			plan, err := x.RepairPlan(lost, vectSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			planned := make(map[int]int)
+			for _, rr := range plan {
+				planned[rr.Index] += rr.Length
+			}
+
+			cnts := make([]*countReaderAt, d+p)
+			sources := make([]io.ReaderAt, d+p)
+			for i := range sources {
+				if _, ok := planned[i]; ok {
+					cnts[i] = &countReaderAt{r: bytes.NewReader(bufs[i].Bytes())}
+					sources[i] = cnts[i]
+				}
+			}
+
+			out := new(bytes.Buffer)
+			err = x.StreamRepair(lost, sources, out, vectSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), bufs[lost].Bytes()) {
+				t.Fatalf("mismatch repaired shard: %d, substripes: %d", lost, sub)
+			}
+			for i, c := range cnts {
+				if c != nil && c.n != planned[i]*stripes {
+					t.Fatalf("mismatch read size of shard %d: %d, exp: %d", i, c.n, planned[i]*stripes)
+				}
+			}
+		}
+
+		// Truncated shard.
+		sources := make([]io.ReaderAt, d+p)
+		for i := range sources {
+			b := bufs[i].Bytes()
+			if i == d {
+				b = b[:len(b)-1]
+			}
+			sources[i] = bytes.NewReader(b)
+		}
+		err = x.StreamRepair(0, sources, new(bytes.Buffer), vectSize)
+		if err == nil {
+			t.Fatal("should return error for truncated shard")
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"fmt"
+)
+
+// Inputs are checked before any byte is touched,
+// so a failed call leaves vects and parity unmodified.
+// These checks make no allocation unless there is an error
+// (or XORSet is checked for the first time, see checkLayout),
+// so they're shared with Workspace.
+
+// checkVects checks the number and sizes of vects,
+// and the layout of x.
+func (x *XRS) checkVects(vects [][]byte) error {
+	err := x.checkLayout()
+	if err != nil {
+		return err
+	}
+	n := x.RS.DataNum + x.RS.ParityNum
+	if len(vects) != n {
+		return fmt.Errorf("%w: %d vects, want %d", ErrTooFewShards, len(vects), n)
+	}
+	return x.checkSizes(vects, len(vects[0]))
+}
+
+// checkSizes checks that every vector in vects has size bytes,
+// and size is legal.
+func (x *XRS) checkSizes(vects [][]byte, size int) error {
+	for i, v := range vects {
+		if v == nil {
+			return fmt.Errorf("%w: vect %d is nil", ErrShardSizeMismatch, i)
+		}
+	}
+	if size == 0 {
+		return fmt.Errorf("%w: %d", ErrOddVectSize, size)
+	}
+	err := x.checkSize(size)
+	if err != nil {
+		return err
+	}
+	for i, v := range vects {
+		if len(v) != size {
+			return fmt.Errorf("%w: vect %d has %d bytes, want %d", ErrShardSizeMismatch, i, len(v), size)
+		}
+	}
+	return nil
+}
+
+// checkDataIndex checks that i is a data index.
+func (x *XRS) checkDataIndex(i int) error {
+	if i < 0 || i >= x.RS.DataNum {
+		return fmt.Errorf("%w: not a data index: %d", ErrIllegalIndex, i)
+	}
+	return nil
+}
+
+// checkReconst checks dpHas and needReconst of Reconst:
+// indexes must be in range without duplicates, dpHas and needReconst must
+// not overlap, and there must be enough available vectors.
+func (x *XRS) checkReconst(dpHas, needReconst []int) error {
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	var has, need [4]uint64
+	for _, i := range dpHas {
+		if i < 0 || i >= d+p {
+			return fmt.Errorf("%w: %d in dpHas", ErrIllegalIndex, i)
+		}
+		if has[i>>6]&(1<<uint(i&63)) != 0 {
+			return fmt.Errorf("%w: duplicated %d in dpHas", ErrIllegalIndex, i)
+		}
+		has[i>>6] |= 1 << uint(i&63)
+	}
+	for _, i := range needReconst {
+		if i < 0 || i >= d+p {
+			return fmt.Errorf("%w: %d in needReconst", ErrIllegalIndex, i)
+		}
+		if need[i>>6]&(1<<uint(i&63)) != 0 {
+			return fmt.Errorf("%w: duplicated %d in needReconst", ErrIllegalIndex, i)
+		}
+		if has[i>>6]&(1<<uint(i&63)) != 0 {
+			return fmt.Errorf("%w: %d is in both dpHas and needReconst", ErrIllegalIndex, i)
+		}
+		need[i>>6] |= 1 << uint(i&63)
+	}
+	if len(dpHas) < d {
+		return fmt.Errorf("%w: %d available, need %d at least", ErrTooFewShards, len(dpHas), d)
+	}
+	return nil
+}
+
+// checkParity checks the number and sizes of parity vectors of Update and Replace,
+// and the layout of x.
+func (x *XRS) checkParity(parity [][]byte, size int) error {
+	err := x.checkLayout()
+	if err != nil {
+		return err
+	}
+	if len(parity) != x.RS.ParityNum {
+		return fmt.Errorf("%w: %d parity vects, want %d", ErrIllegalParity, len(parity), x.RS.ParityNum)
+	}
+	for i, v := range parity {
+		if len(v) != size {
+			return fmt.Errorf("%w: parity %d has %d bytes, want %d", ErrShardSizeMismatch, i, len(v), size)
+		}
+	}
+	return nil
+}
+
+// checkUpdate checks the arguments of Update.
+func (x *XRS) checkUpdate(oldData, newData []byte, row int, parity [][]byte) error {
+	size := len(oldData)
+	if size == 0 {
+		return fmt.Errorf("%w: %d", ErrOddVectSize, size)
+	}
+	err := x.checkSize(size)
+	if err != nil {
+		return err
+	}
+	if len(newData) != size {
+		return fmt.Errorf("%w: new data has %d bytes, want %d", ErrShardSizeMismatch, len(newData), size)
+	}
+	err = x.checkDataIndex(row)
+	if err != nil {
+		return err
+	}
+	return x.checkParity(parity, size)
+}
+
+// checkUpdateMany checks the arguments of UpdateMany.
+func (x *XRS) checkUpdateMany(oldData, newData [][]byte, rows []int, parity [][]byte) error {
+	err := x.checkReplace(oldData, rows, parity)
+	if err != nil {
+		return err
+	}
+	if len(newData) != len(oldData) {
+		return fmt.Errorf("%w: %d new data, %d old data", ErrIllegalIndex, len(newData), len(oldData))
+	}
+	return x.checkSizes(newData, len(oldData[0]))
+}
+
+// checkReplace checks the arguments of Replace.
+func (x *XRS) checkReplace(data [][]byte, replaceRows []int, parity [][]byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("%w: no data", ErrTooFewShards)
+	}
+	if len(data) != len(replaceRows) || len(data) > x.RS.DataNum {
+		return fmt.Errorf("%w: %d data, %d rows", ErrIllegalIndex, len(data), len(replaceRows))
+	}
+	var rows [4]uint64
+	for _, i := range replaceRows {
+		err := x.checkDataIndex(i)
+		if err != nil {
+			return err
+		}
+		if rows[i>>6]&(1<<uint(i&63)) != 0 {
+			return fmt.Errorf("%w: duplicated row %d", ErrIllegalIndex, i)
+		}
+		rows[i>>6] |= 1 << uint(i&63)
+	}
+	size := len(data[0])
+	err := x.checkSizes(data, size)
+	if err != nil {
+		return err
+	}
+	return x.checkParity(parity, size)
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"errors"
+	"testing"
+)
+
+// codec is implemented by both XRS and Workspace.
+type codec interface {
+	Encode(vects [][]byte) error
+	ReconstOne(vects [][]byte, needReconst int) error
+	ReconstParity(vects [][]byte, needReconst int) error
+	Reconst(vects [][]byte, dpHas, needReconst []int) error
+	Update(oldData, newData []byte, row int, parity [][]byte) error
+	Replace(data [][]byte, replaceRows []int, parity [][]byte) error
+	UpdateMany(oldData, newData [][]byte, rows []int, parity [][]byte) error
+}
+
+func TestValidate(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := newShardMatrix(d+p, testShardSize)
+	for j := 0; j < d; j++ {
+		fillRandom(t, r, exp[j])
+	}
+	err = x.Encode(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := make([]int, d+p)
+	for i := range all {
+		all[i] = i
+	}
+
+	cases := []struct {
+		name string
+		exp  error
+		f    func(c codec, vects [][]byte) error
+	}{
+		{"encode: vects number", ErrTooFewShards, func(c codec, vects [][]byte) error {
+			return c.Encode(vects[:d+p-1])
+		}},
+		{"encode: nil vect", ErrShardSizeMismatch, func(c codec, vects [][]byte) error {
+			vects[d+1] = nil
+			return c.Encode(vects)
+		}},
+		{"encode: size mismatch", ErrShardSizeMismatch, func(c codec, vects [][]byte) error {
+			vects[d] = vects[d][:testShardSize-2]
+			return c.Encode(vects)
+		}},
+		{"encode: odd size", ErrOddVectSize, func(c codec, vects [][]byte) error {
+			for i := range vects {
+				vects[i] = vects[i][:testShardSize-1]
+			}
+			return c.Encode(vects)
+		}},
+		{"reconstOne: negative index", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.ReconstOne(vects, -1)
+		}},
+		{"reconstOne: parity index", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.ReconstOne(vects, d)
+		}},
+		{"reconstOne: size mismatch", ErrShardSizeMismatch, func(c codec, vects [][]byte) error {
+			vects[d+p-1] = vects[d+p-1][:2]
+			return c.ReconstOne(vects, 0)
+		}},
+		{"reconstParity: data index", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.ReconstParity(vects, 0)
+		}},
+		{"reconstParity: nil vect", ErrShardSizeMismatch, func(c codec, vects [][]byte) error {
+			vects[0] = nil
+			return c.ReconstParity(vects, d)
+		}},
+		{"reconst: duplicated dpHas", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.Reconst(vects, append(all[1:d+1:d+1], 1), []int{0})
+		}},
+		{"reconst: duplicated needReconst", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.Reconst(vects, all[2:], []int{0, 1, 0})
+		}},
+		{"reconst: out of range", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.Reconst(vects, all[1:], []int{d + p})
+		}},
+		{"reconst: negative", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.Reconst(vects, append([]int{-1}, all[1:]...), []int{0})
+		}},
+		{"reconst: overlap", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.Reconst(vects, all[1:], []int{0, 1})
+		}},
+		{"reconst: too few", ErrTooFewShards, func(c codec, vects [][]byte) error {
+			return c.Reconst(vects, all[p+1:], all[:p+1])
+		}},
+		{"reconst: size mismatch", ErrShardSizeMismatch, func(c codec, vects [][]byte) error {
+			vects[d+1] = vects[d+1][:testShardSize/2]
+			return c.Reconst(vects, all[2:], []int{0, 1})
+		}},
+		{"update: new data size", ErrShardSizeMismatch, func(c codec, vects [][]byte) error {
+			return c.Update(vects[0], vects[1][:2], 0, vects[d:])
+		}},
+		{"update: parity number", ErrIllegalParity, func(c codec, vects [][]byte) error {
+			return c.Update(vects[0], vects[1], 0, vects[d+1:])
+		}},
+		{"update: parity size", ErrShardSizeMismatch, func(c codec, vects [][]byte) error {
+			vects[d+1] = vects[d+1][:2]
+			return c.Update(vects[0], vects[1], 0, vects[d:])
+		}},
+		{"update: row", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.Update(vects[0], vects[1], d, vects[d:])
+		}},
+		{"update: empty", ErrOddVectSize, func(c codec, vects [][]byte) error {
+			return c.Update(nil, nil, 0, vects[d:])
+		}},
+		{"replace: empty", ErrTooFewShards, func(c codec, vects [][]byte) error {
+			return c.Replace(nil, nil, vects[d:])
+		}},
+		{"replace: duplicated rows", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.Replace(vects[:2], []int{1, 1}, vects[d:])
+		}},
+		{"replace: rows number", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.Replace(vects[:2], []int{1}, vects[d:])
+		}},
+		{"replace: data size", ErrShardSizeMismatch, func(c codec, vects [][]byte) error {
+			data := [][]byte{vects[0], vects[1][:2]}
+			return c.Replace(data, []int{0, 1}, vects[d:])
+		}},
+		{"updateMany: new data number", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.UpdateMany(vects[:2], vects[2:3], []int{0, 1}, vects[d:])
+		}},
+		{"updateMany: new data size", ErrShardSizeMismatch, func(c codec, vects [][]byte) error {
+			return c.UpdateMany(vects[:2], [][]byte{vects[2], vects[3][:2]}, []int{0, 1}, vects[d:])
+		}},
+		{"updateMany: duplicated rows", ErrIllegalIndex, func(c codec, vects [][]byte) error {
+			return c.UpdateMany(vects[:2], vects[2:4], []int{1, 1}, vects[d:])
+		}},
+	}
+
+	codecs := map[string]codec{"XRS": x, "Workspace": x.NewWorkspace()}
+	for cn, c := range codecs {
+		for _, cs := range cases {
+			act := newShardMatrix(d+p, testShardSize)
+			for i := range act {
+				copy(act[i], exp[i])
+			}
+			vects := make([][]byte, d+p)
+			copy(vects, act)
+
+			err = cs.f(c, vects)
+			if !errors.Is(err, cs.exp) {
+				t.Fatalf("%s %s: mismatch error: %v, exp: %v", cn, cs.name, err, cs.exp)
+			}
+			assertVectsEqual(t, exp, act, cn+" "+cs.name)
+		}
+	}
+}
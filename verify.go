@@ -0,0 +1,212 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Verify checks whether the parity vectors in vects are consistent
+// with the data vectors. vects is not modified.
+//
+// ok is false if any sub-stripe is inconsistent,
+// see VerifySubstripes for finding out which one.
+func (x *XRS) Verify(vects [][]byte) (ok bool, err error) {
+	bad, err := x.VerifySubstripes(vects)
+	if err != nil {
+		return
+	}
+	return len(bad) == 0, nil
+}
+
+// VerifySubstripes returns the indexes of inconsistent sub-stripes
+// (with two sub-stripes, 0 is the a-half and 1 is the b-half).
+// vects is not modified.
+//
+// Each sub-stripe of all vectors is a Reed-Solomon codeword
+// once the XOR terms are removed from the last sub-stripe of parity vectors
+// (as retrieveRS does, but on a copy), so each of them is checked alone.
+func (x *XRS) VerifySubstripes(vects [][]byte) (bad []int, err error) {
+
+	err = x.checkVects(vects)
+	if err != nil {
+		return
+	}
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	n := len(vects[0]) / x.substripes()
+	last := x.substripes() - 1
+
+	buf := make([]byte, 2*p*n)
+	tmp := make([][]byte, d+p)
+	for s := 0; s < x.substripes(); s++ {
+		for i := 0; i < d; i++ {
+			tmp[i] = x.sub(vects[i], s)
+		}
+		for j := 0; j < p; j++ {
+			tmp[d+j] = buf[j*n : j*n+n]
+		}
+		err = x.RS.Encode(tmp)
+		if err != nil {
+			return nil, wrapRS(err)
+		}
+
+		for j := 0; j < p; j++ {
+			got := x.sub(vects[d+j], s)
+			if s == last {
+				b := buf[(p+j)*n : (p+j)*n+n]
+				copy(b, got)
+				x.xorTermsInto(b, vects, d+j, 0)
+				got = b
+			}
+			if !bytes.Equal(got, tmp[d+j]) {
+				bad = append(bad, s)
+				break
+			}
+		}
+	}
+	return
+}
+
+// LocateCorruption returns the indexes of corrupted vectors in vects.
+// vects is not modified.
+//
+// At most ParityNum/2 corrupted vectors can be located,
+// an error is returned if there are more.
+//
+// The non-last sub-stripes (a-halves) are Reed-Solomon codewords,
+// so they're checked and corrected first; then the last sub-stripes
+// (b-halves) are checked after removing the XOR terms with the corrected data.
+// It tries every candidate set of corrupted vectors (fewest first),
+// so it's much slower than Verify.
+func (x *XRS) LocateCorruption(vects [][]byte) (bad []int, err error) {
+
+	err = x.checkVects(vects)
+	if err != nil {
+		return
+	}
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	size := len(vects[0])
+	c := make([][]byte, d+p)
+	for i := range c {
+		c[i] = make([]byte, size)
+		copy(c[i], vects[i])
+	}
+
+	maxBad := p / 2
+	last := x.substripes() - 1
+	loc := &locator{x: x, buf: make([]byte, p*(size/x.substripes()))}
+	sv := make([][]byte, d+p)
+	for s := 0; s <= last; s++ {
+		if s == last { // a-sub-stripes have been corrected.
+			for i := d + 1; i < d+p; i++ {
+				x.xorTerms(c, i)
+			}
+		}
+		for i := range c {
+			sv[i] = x.sub(c[i], s)
+		}
+		e, err2 := loc.locate(sv, maxBad)
+		if err2 != nil {
+			return nil, err2
+		}
+		for _, i := range e {
+			if !isIn(i, bad) {
+				bad = append(bad, i)
+			}
+		}
+	}
+
+	if len(bad) > maxBad {
+		return nil, ErrTooManyCorrupted
+	}
+	sort.Ints(bad)
+	return
+}
+
+// locator finds corrupted vectors in a Reed-Solomon codeword.
+type locator struct {
+	x   *XRS
+	buf []byte // Scratch for ParityNum vectors.
+}
+
+// locate returns the indexes of corrupted vectors in codeword vects
+// (at most maxBad), and corrects them in place.
+func (l *locator) locate(vects [][]byte, maxBad int) (bad []int, err error) {
+
+	n := len(vects)
+	for k := 0; k <= maxBad; k++ {
+		e := make([]int, k)
+		for i := range e {
+			e[i] = i
+		}
+		for {
+			ok, err2 := l.try(vects, e)
+			if err2 != nil {
+				return nil, err2
+			}
+			if ok {
+				return e, nil
+			}
+			if !nextCombination(e, n) {
+				break
+			}
+		}
+	}
+	return nil, ErrTooManyCorrupted
+}
+
+// try reports whether vects is a codeword once vectors in e are erased.
+// If it is, vectors in e are corrected.
+func (l *locator) try(vects [][]byte, e []int) (ok bool, err error) {
+
+	d, p := l.x.RS.DataNum, l.x.RS.ParityNum
+	size := len(vects[0])
+	dpHas := make([]int, 0, d)
+	need := make([]int, 0, p)
+	tmp := make([][]byte, d+p)
+	for i := range vects {
+		if len(dpHas) < d && !isIn(i, e) {
+			dpHas = append(dpHas, i)
+			tmp[i] = vects[i]
+			continue
+		}
+		tmp[i] = l.buf[len(need)*size : len(need)*size+size]
+		need = append(need, i)
+	}
+
+	err = l.x.RS.Reconst(tmp, dpHas, need)
+	if err != nil {
+		return false, wrapRS(err)
+	}
+	for _, i := range need {
+		if !isIn(i, e) && !bytes.Equal(tmp[i], vects[i]) {
+			return false, nil
+		}
+	}
+	for _, i := range e {
+		copy(vects[i], tmp[i])
+	}
+	return true, nil
+}
+
+// nextCombination moves e to the next k-combination of [0, n) in
+// lexicographic order, it returns false if e is the last one.
+func nextCombination(e []int, n int) bool {
+	k := len(e)
+	for i := k - 1; i >= 0; i-- {
+		if e[i] < n-k+i {
+			e[i]++
+			for j := i + 1; j < k; j++ {
+				e[j] = e[j-1] + 1
+			}
+			return true
+		}
+	}
+	return false
+}
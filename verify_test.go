@@ -0,0 +1,175 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+)
+
+func TestXRS_Verify(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := sub * 64
+		vects := newShardMatrix(d+p, size)
+		for j := 0; j < d; j++ {
+			fillRandom(t, r, vects[j])
+		}
+		err = x.Encode(vects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bak := newShardMatrix(d+p, size)
+		for j := range vects {
+			copy(bak[j], vects[j])
+		}
+
+		ok, err := x.Verify(vects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("verify failed")
+		}
+
+		for i := 0; i < d+p; i++ {
+			for s := 0; s < sub; s++ {
+				off := s*size/sub + r.Intn(size/sub)
+				vects[i][off] ^= 1
+
+				ok, err = x.Verify(vects)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					t.Fatalf("should find corruption; vect: %d, substripe: %d", i, s)
+				}
+				bad, err := x.VerifySubstripes(vects)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Corruption in a-sub-stripes of data vectors also breaks
+				// the last sub-stripe of the parity carrying them.
+				exp := []int{s}
+				if i < d && s < sub-1 {
+					exp = append(exp, sub-1)
+				}
+				if len(bad) != len(exp) || bad[0] != exp[0] || bad[len(bad)-1] != exp[len(exp)-1] {
+					t.Fatalf("mismatch bad sub-stripes: %v; vect: %d, substripe: %d", bad, i, s)
+				}
+
+				vects[i][off] ^= 1
+			}
+		}
+
+		for j := range vects {
+			if !bytes.Equal(bak[j], vects[j]) {
+				t.Fatal("verify should not modify vects")
+			}
+		}
+	}
+}
+
+func TestXRS_VerifyIllegal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = x.Verify(newShardMatrix(d+p-1, 2))
+	if err == nil {
+		t.Fatal("should return error for illegal vects number")
+	}
+	_, err = x.Verify(newShardMatrix(d+p, 3))
+	if err == nil {
+		t.Fatal("should return error for illegal vect size")
+	}
+	vects := newShardMatrix(d+p, 4)
+	vects[d+1] = make([]byte, 2)
+	_, err = x.Verify(vects)
+	if err == nil {
+		t.Fatal("should return error for mismatched vect size")
+	}
+}
+
+func TestXRS_LocateCorruption(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := sub * 32
+		exp := newShardMatrix(d+p, size)
+		for j := 0; j < d; j++ {
+			fillRandom(t, r, exp[j])
+		}
+		err = x.Encode(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for loop := 0; loop < 32; loop++ {
+			act := newShardMatrix(d+p, size)
+			for j := range act {
+				copy(act[j], exp[j])
+			}
+			corrupted := makeLostRandom(r, d+p, r.Intn(p/2+1))
+			sort.Ints(corrupted)
+			for _, c := range corrupted {
+				act[c][r.Intn(size)] ^= byte(r.Intn(255) + 1)
+			}
+
+			bad, err := x.LocateCorruption(act)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bad) != len(corrupted) {
+				t.Fatalf("mismatch corrupted vects: %v, exp: %v", bad, corrupted)
+			}
+			for j := range bad {
+				if bad[j] != corrupted[j] {
+					t.Fatalf("mismatch corrupted vects: %v, exp: %v", bad, corrupted)
+				}
+			}
+			for _, c := range corrupted {
+				if bytes.Equal(act[c], exp[c]) {
+					t.Fatal("locateCorruption should not modify vects")
+				}
+			}
+		}
+	}
+}
+
+func TestNextCombination(t *testing.T) {
+	n, k := 6, 3
+	e := []int{0, 1, 2}
+	cnt := 1
+	for nextCombination(e, n) {
+		cnt++
+		for i := 1; i < k; i++ {
+			if e[i] <= e[i-1] {
+				t.Fatal("illegal combination", e)
+			}
+		}
+	}
+	if cnt != 20 {
+		t.Fatal("mismatch combinations count", cnt)
+	}
+	if nextCombination(nil, n) {
+		t.Fatal("empty combination has no next")
+	}
+}
@@ -0,0 +1,536 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"fmt"
+	"sync"
+
+	rs "github.com/templexxx/reedsolomon"
+	xor "github.com/templexxx/xorsimd"
+)
+
+// Workspace holds buffers which are reused between calls,
+// so steady-state Encode, Update, Replace and reconstruction don't make
+// any heap allocation.
+//
+// XRS methods borrow a Workspace from a pool and call the same methods of it,
+// so a Workspace only saves the pool when the caller keeps one.
+// Matrices and plans are made on the first use of each pattern and kept by the XRS.
+//
+// A Workspace is bound to the XRS which made it (RS must not be changed
+// after that), and it must not be used concurrently.
+type Workspace struct {
+	x    *XRS
+	pool *sync.Pool // Where it's borrowed from, see borrow.
+
+	sv    [][]byte // Sub-stripes of vectors, len is DataNum+ParityNum.
+	tmp   [][]byte // Input of backend codec, len is DataNum+ParityNum.
+	xv    [][]byte // Sources of XOR.
+	dv    [][]byte // Deltas of Update and UpdateMany.
+	row   []int    // Row of Update.
+	has   []int
+	need  []int
+	order []int
+	parts [][][]byte // Sub-stripes of vectors for reconstOne.
+	buf   []byte     // Scratch for sub-stripes or parity.
+	delta []byte     // Scratch for deltas of Update and UpdateMany.
+}
+
+// NewWorkspace makes a Workspace for x.
+func (x *XRS) NewWorkspace() *Workspace {
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	w := &Workspace{
+		x:     x,
+		sv:    make([][]byte, d+p),
+		tmp:   make([][]byte, d+p),
+		xv:    make([][]byte, 0, d+2),
+		dv:    make([][]byte, 1, d),
+		row:   make([]int, 1),
+		has:   make([]int, 0, d+p),
+		need:  make([]int, 0, d+p),
+		order: make([]int, 0, d),
+		parts: make([][][]byte, d+p),
+	}
+	for i := range w.parts {
+		w.parts[i] = make([][]byte, x.substripes())
+	}
+	return w
+}
+
+// Encode is as same as XRS.Encode.
+func (w *Workspace) Encode(vects [][]byte) (err error) {
+	x := w.x
+	err = x.checkVects(vects)
+	if err != nil {
+		return
+	}
+
+	err = x.RS.Encode(vects)
+	if err != nil {
+		return wrapRS(err)
+	}
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	for i := d + 1; i < d+p; i++ {
+		w.xorTerms(vects, i)
+	}
+	return
+}
+
+// ReconstOne is as same as XRS.ReconstOne.
+func (w *Workspace) ReconstOne(vects [][]byte, needReconst int) (err error) {
+	x := w.x
+	err = x.checkVects(vects)
+	if err != nil {
+		return
+	}
+	err = x.checkDataIndex(needReconst)
+	if err != nil {
+		return
+	}
+
+	for i, v := range vects {
+		w.parts[i] = w.parts[i][:x.substripes()]
+		for s := range w.parts[i] {
+			w.parts[i][s] = x.sub(v, s)
+		}
+	}
+	return w.reconstOne(w.parts, needReconst, w.parts[needReconst])
+}
+
+// reconstOne reconstructs data vector needReconst into dst,
+// parts[i][s] is sub-stripe s of vector i and dst[s] is sub-stripe s of the result.
+// Only the sub-stripes needed by GetNeedVects are read.
+func (w *Workspace) reconstOne(parts [][][]byte, needReconst int, dst [][]byte) (err error) {
+	x := w.x
+	d := x.RS.DataNum
+	w.has = w.has[:0]
+	for i := 0; i < d; i++ {
+		if i != needReconst {
+			w.has = append(w.has, i)
+		}
+	}
+	w.has = append(w.has, d) // Replace needReconst with DataNum.
+	w.need = append(w.need[:0], needReconst)
+
+	if x.RS.ParityNum == 1 { // No XOR terms, every sub-stripe is reconstructed by Reed-Solomon.
+		for s := range dst {
+			for _, i := range w.has {
+				w.sv[i] = parts[i][s]
+			}
+			w.sv[needReconst] = dst[s]
+			err = w.decode(w.sv, w.has, w.need)
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	// Step 1: Reconstruct b_needReconst and rs(bNeed[1:]) using Reed-Solomon.
+	bNeed := x.layout().bNeed[needReconst]
+	last := x.substripes() - 1
+	n := len(dst[last])
+	bRS := grow(&w.buf, last*n)
+	for _, i := range w.has {
+		w.sv[i] = parts[i][last]
+	}
+	w.sv[needReconst] = dst[last]
+	for s, bi := range bNeed[1:] { // B index in XORSet.
+		w.sv[bi] = bRS[s*n : s*n+n]
+		w.need = append(w.need, bi)
+	}
+	err = w.decode(w.sv, w.has, w.need)
+	if err != nil {
+		return
+	}
+
+	// Step 2: Reconstruct a_needReconst (every sub-stripe except the last).
+	// ∵ a_needReconst ⊕ a_need ⊕ bRS = vects[bi]
+	// ∴ a_needReconst = vects[bi] ⊕ bRS ⊕ a_need
+	for s, bi := range bNeed[1:] {
+		xv := append(w.xv[:0], parts[bi][last], bRS[s*n:s*n+n])
+		for _, t := range x.terms(bi) {
+			if t.index != needReconst {
+				xv = append(xv, parts[t.index][t.sub])
+			}
+		}
+		xor.Encode(dst[s], xv)
+	}
+	return
+}
+
+// ReconstParity is as same as XRS.ReconstParity.
+func (w *Workspace) ReconstParity(vects [][]byte, needReconst int) (err error) {
+	x := w.x
+	err = x.checkVects(vects)
+	if err != nil {
+		return
+	}
+	d := x.RS.DataNum
+	if needReconst < d || needReconst >= d+x.RS.ParityNum {
+		return fmt.Errorf("%w: not a parity index: %d", ErrIllegalIndex, needReconst)
+	}
+
+	w.has = w.has[:0]
+	for i := 0; i < d; i++ {
+		w.has = append(w.has, i)
+	}
+	w.need = append(w.need[:0], needReconst)
+	err = w.decode(vects, w.has, w.need)
+	if err != nil {
+		return
+	}
+	w.xorTerms(vects, needReconst)
+	return
+}
+
+// Reconst is as same as XRS.Reconst.
+func (w *Workspace) Reconst(vects [][]byte, dpHas, needReconst []int) (err error) {
+	return w.reconst(vects, dpHas, needReconst, false)
+}
+
+// ReconstPreserveInputs is as same as XRS.ReconstPreserveInputs.
+func (w *Workspace) ReconstPreserveInputs(vects [][]byte, dpHas, needReconst []int) (err error) {
+	return w.reconst(vects, dpHas, needReconst, true)
+}
+
+func (w *Workspace) reconst(vects [][]byte, dpHas, needReconst []int, preserve bool) (err error) {
+	x := w.x
+	d := x.RS.DataNum
+
+	err = x.checkVects(vects)
+	if err != nil {
+		return
+	}
+	err = x.checkReconst(dpHas, needReconst)
+	if err != nil {
+		return
+	}
+	if len(needReconst) == 0 {
+		return
+	}
+
+	if len(needReconst) == 1 && needReconst[0] < d {
+		if x.hasForOne(dpHas, x.layout().bNeed[needReconst[0]], needReconst[0]) {
+			return w.ReconstOne(vects, needReconst[0])
+		}
+	}
+	if len(needReconst) == 1 && x.hasAllData(dpHas) {
+		return w.ReconstParity(vects, needReconst[0])
+	}
+	if len(needReconst) > 1 && x.isLostData(dpHas, needReconst) {
+		pl := x.plan(dpHas)
+		if pl.piggyback {
+			return w.reconstMulti(vects, pl)
+		}
+	}
+
+	// Step 1: Reconstruct needed a-vectors.
+	split := len(vects[0]) / x.substripes() * (x.substripes() - 1)
+	for i, v := range vects {
+		w.sv[i] = v[:split]
+	}
+	w.has = append(w.has[:0], dpHas...)
+	w.need = x.appendANeed(w.need[:0], dpHas, needReconst)
+	err = w.decode(w.sv, w.has, w.need)
+	if err != nil {
+		return
+	}
+
+	// Step 2: Convert available b-vectors back to RS form.
+	w.retrieveRS(vects, dpHas)
+
+	// Step 3: Reconstruct b-vectors using RS codes.
+	for i, v := range vects {
+		w.sv[i] = v[split:]
+	}
+	w.has = append(w.has[:0], dpHas...)
+	w.need = append(w.need[:0], needReconst...)
+	err = w.decode(w.sv, w.has, w.need)
+	if err != nil {
+		// Restore the available b-vectors, xorTerms is an involution
+		// and the a-vectors haven't been changed since Step 1.
+		w.retrieveRS(vects, dpHas)
+		return
+	}
+
+	// Step 4: Apply XOR to b-parity-vectors according to XORSet.
+	for _, i := range needReconst {
+		if i > d {
+			w.xorTerms(vects, i)
+		}
+	}
+
+	if preserve {
+		w.retrieveRS(vects, dpHas) // Convert back to XRS form.
+	}
+	return
+}
+
+// retrieveRS converts available b-parity-vectors back to RS form
+// by XOR-ing with the corresponding a-vectors defined in XORSet.
+func (w *Workspace) retrieveRS(vects [][]byte, dpHas []int) {
+	for _, h := range dpHas {
+		if h > w.x.RS.DataNum { // vects[data] is rs_codes
+			w.xorTerms(vects, h)
+		}
+	}
+}
+
+// reconstMulti reconstructs lost data vectors with piggyback by plan pl,
+// only the sub-stripes in pl.need are read.
+func (w *Workspace) reconstMulti(vects [][]byte, pl *multiPlan) (err error) {
+	x := w.x
+	d := x.RS.DataNum
+	last := x.substripes() - 1
+	n := len(vects[0]) / x.substripes()
+	buf := grow(&w.buf, (len(pl.helpers)+len(pl.carriers))*n)
+
+	// Step 1: Reconstruct the last sub-stripe of lost data vectors
+	// and RS form of carriers, helpers are converted back to RS form in scratch.
+	for i := 0; i < d; i++ {
+		w.sv[i] = x.sub(vects[i], last)
+	}
+	for j, h := range pl.helpers {
+		w.sv[h] = x.sub(vects[h], last)
+		if h > d {
+			c := buf[j*n : j*n+n]
+			copy(c, w.sv[h])
+			xv := append(w.xv[:0], c)
+			for _, t := range x.terms(h) {
+				xv = append(xv, x.sub(vects[t.index], t.sub))
+			}
+			xor.Encode(c, xv)
+			w.sv[h] = c
+		}
+	}
+	buf = buf[len(pl.helpers)*n:]
+	for j, e := range pl.carriers {
+		w.sv[e] = buf[j*n : j*n+n]
+	}
+	w.has = append(w.has[:0], pl.bHas...)
+	w.need = append(w.need[:0], pl.bNeed...)
+	err = w.decode(w.sv, w.has, w.need)
+	if err != nil {
+		return
+	}
+
+	// Step 2: Reconstruct other sub-stripes by XOR.
+	// ∵ a_t ⊕ other terms ⊕ rs(e) = vects[e]
+	// ∴ a_t = vects[e] ⊕ rs(e) ⊕ other terms
+	for j, e := range pl.carriers {
+		t := pl.carried[j]
+		xv := append(w.xv[:0], x.sub(vects[e], last), w.sv[e])
+		for _, tm := range x.terms(e) {
+			if tm != t {
+				xv = append(xv, x.sub(vects[tm.index], tm.sub))
+			}
+		}
+		xor.Encode(x.sub(vects[t.index], t.sub), xv)
+	}
+
+	// Step 3: Reconstruct other sub-stripes by Reed-Solomon.
+	for s, rh := range pl.rsHas {
+		if rh == nil {
+			continue
+		}
+		for i, v := range vects {
+			w.sv[i] = x.sub(v, s)
+		}
+		w.has = append(w.has[:0], rh...)
+		w.need = append(w.need[:0], pl.data...)
+		err = w.decode(w.sv, w.has, w.need)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Update is as same as XRS.Update.
+func (w *Workspace) Update(oldData, newData []byte, row int, parity [][]byte) (err error) {
+	x := w.x
+	err = x.checkUpdate(oldData, newData, row, parity)
+	if err != nil {
+		return
+	}
+
+	size := len(oldData)
+	w.dv[0] = grow(&w.delta, size)
+	xor.Encode(w.dv[0], append(w.xv[:0], oldData, newData))
+
+	w.row[0] = row
+	return w.replace(w.dv, w.row, parity)
+}
+
+// UpdateMany is as same as XRS.UpdateMany.
+func (w *Workspace) UpdateMany(oldData, newData [][]byte, rows []int, parity [][]byte) (err error) {
+	x := w.x
+	err = x.checkUpdateMany(oldData, newData, rows, parity)
+	if err != nil {
+		return
+	}
+
+	size := len(oldData[0])
+	buf := grow(&w.delta, size*len(rows))
+	dv := w.dv[:len(rows)]
+	for i := range rows {
+		dv[i] = buf[i*size : i*size+size]
+		xor.Encode(dv[i], append(w.xv[:0], oldData[i], newData[i]))
+	}
+	return w.replace(dv, rows, parity)
+}
+
+// Replace is as same as XRS.Replace.
+func (w *Workspace) Replace(data [][]byte, replaceRows []int, parity [][]byte) (err error) {
+	x := w.x
+	err = x.checkReplace(data, replaceRows, parity)
+	if err != nil {
+		return
+	}
+	return w.replace(data, replaceRows, parity)
+}
+
+// replace XORs the contribution of data (at replaceRows) into parity,
+// arguments have been checked.
+func (w *Workspace) replace(data [][]byte, replaceRows []int, parity [][]byte) (err error) {
+	x := w.x
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	size := len(data[0])
+
+	// Step 1: Reed-Solomon. The backend has no public method for XOR-ing
+	// results into parity without allocation, so encode into buffer first.
+	u, err := w.updater(replaceRows)
+	if err != nil {
+		return
+	}
+	rn := len(replaceRows)
+	buf := grow(&w.buf, size*p)
+	for j, k := range w.order { // w.order is made by updater.
+		w.tmp[j] = data[k]
+	}
+	for j := 0; j < p; j++ {
+		w.tmp[rn+j] = buf[j*size : j*size+size]
+	}
+	err = u.Encode(w.tmp[:rn+p])
+	if err != nil {
+		return wrapRS(err)
+	}
+	for j := 0; j < p; j++ {
+		xor.Encode(parity[j], append(w.xv[:0], parity[j], w.tmp[rn+j]))
+	}
+
+	// Step 2: XOR based on XORSet.
+	last := x.substripes() - 1
+	for i, row := range replaceRows {
+		for s, bi := range x.layout().bNeed[row][1:] {
+			bv := x.sub(parity[bi-d], last)
+			xor.Encode(bv, append(w.xv[:0], bv, x.sub(data[i], s)))
+		}
+	}
+	return
+}
+
+// updater returns the codec which multiplies the columns of
+// generator matrix at replaceRows (in ascending order) by data.
+// w.order is set to the indexes of replaceRows in ascending order.
+func (w *Workspace) updater(replaceRows []int) (u *rs.RS, err error) {
+
+	w.order = w.order[:0]
+	for i := range replaceRows {
+		w.order = append(w.order, i)
+	}
+	for i := 1; i < len(w.order); i++ { // Insertion sort without allocation.
+		for j := i; j > 0 && replaceRows[w.order[j]] < replaceRows[w.order[j-1]]; j-- {
+			w.order[j], w.order[j-1] = w.order[j-1], w.order[j]
+		}
+	}
+
+	var key [4]uint64
+	for _, row := range replaceRows {
+		key[row>>6] |= 1 << uint(row&63)
+	}
+	x := w.x
+	l := x.layout()
+	v, ok := l.updaters.Load(key)
+	if ok {
+		return v.(*rs.RS), nil
+	}
+
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	rn := len(replaceRows)
+	gm := make([]byte, p*rn)
+	for i := 0; i < p; i++ {
+		for j, k := range w.order {
+			gm[i*rn+j] = x.RS.GenMatrix[i*d+replaceRows[k]]
+		}
+	}
+	u = x.codec(rn, gm)
+	l.updaters.Store(key, u)
+	return
+}
+
+// decode reconstructs vects[need] from vects[has] (only the first DataNum
+// indexes in ascending order are used). has and need may be sorted.
+func (w *Workspace) decode(vects [][]byte, has, need []int) (err error) {
+
+	d := w.x.RS.DataNum
+	if len(need) == 0 {
+		return
+	}
+	if len(has) < d || len(need) > w.x.RS.ParityNum {
+		return fmt.Errorf("%w: %d available, %d needed", ErrTooFewShards, len(has), len(need))
+	}
+	sortInts(has)
+	sortInts(need)
+	has = has[:d]
+
+	r, err := w.x.decoder(has, need)
+	if err != nil {
+		return
+	}
+	for j, i := range has {
+		w.tmp[j] = vects[i]
+	}
+	for j, i := range need {
+		w.tmp[d+j] = vects[i]
+	}
+	return wrapRS(r.Encode(w.tmp[:d+len(need)]))
+}
+
+// xorTerms is as same as XRS.xorTerms but without allocation.
+func (w *Workspace) xorTerms(vects [][]byte, p int) {
+	x := w.x
+	ts := x.terms(p)
+	if len(ts) == 0 {
+		return
+	}
+	b := x.sub(vects[p], x.substripes()-1)
+	xv := append(w.xv[:0], b)
+	for _, t := range ts {
+		xv = append(xv, x.sub(vects[t.index], t.sub))
+	}
+	xor.Encode(b, xv)
+}
+
+// grow returns *buf with n bytes, *buf is reallocated if it's too small.
+func grow(buf *[]byte, n int) []byte {
+	if cap(*buf) < n {
+		*buf = make([]byte, n)
+	}
+	return (*buf)[:n]
+}
+
+// sortInts sorts s in ascending order without allocation.
+func sortInts(s []int) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && s[j] < s[j-1]; j-- {
+			s[j], s[j-1] = s[j-1], s[j]
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWorkspace(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := x.NewWorkspace()
+		size := sub * 64
+
+		for loop := 0; loop < 64; loop++ {
+			exp := newShardMatrix(d+p, size)
+			act := newShardMatrix(d+p, size)
+			for j := 0; j < d; j++ {
+				fillRandom(t, r, exp[j])
+				copy(act[j], exp[j])
+			}
+			err = x.Encode(exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = w.Encode(act)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertVectsEqual(t, exp, act, "encode")
+
+			// Reconst.
+			lost := makeLostRandom(r, d+p, r.Intn(p)+1)
+			needReconst := lost[:r.Intn(len(lost))+1]
+			dpHas := makeHasFromLost(d+p, lost)
+			if len(needReconst) == 1 {
+				dpHas = makeHasFromLost(d+p, needReconst)
+			}
+			for _, l := range needReconst {
+				act[l] = make([]byte, size)
+			}
+			err = w.Reconst(act, dpHas, append([]int(nil), needReconst...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, l := range needReconst {
+				if !bytes.Equal(exp[l], act[l]) {
+					t.Fatalf("reconst failed: vect: %d, lost: %v", l, lost)
+				}
+			}
+
+			// Update.
+			for j := range act {
+				copy(act[j], exp[j])
+			}
+			row := r.Intn(d)
+			newData := make([]byte, size)
+			fillRandom(t, r, newData)
+			err = w.Update(act[row], newData, row, act[d:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			copy(act[row], newData)
+			copy(exp[row], newData)
+			err = x.Encode(exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertVectsEqual(t, exp, act, "update")
+
+			// UpdateMany.
+			rows := makeReplaceRowsRandom(r, d)
+			olds := make([][]byte, len(rows))
+			news := newShardMatrix(len(rows), size)
+			for j, row := range rows {
+				olds[j] = act[row]
+				fillRandom(t, r, news[j])
+			}
+			err = w.UpdateMany(olds, news, rows, act[d:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j, row := range rows {
+				copy(act[row], news[j])
+				copy(exp[row], news[j])
+			}
+			err = x.Encode(exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertVectsEqual(t, exp, act, "updateMany")
+
+			// Replace.
+			rows = makeReplaceRowsRandom(r, d)
+			data := make([][]byte, len(rows))
+			for j, row := range rows {
+				data[j] = make([]byte, size)
+				copy(data[j], exp[row])
+				exp[row] = make([]byte, size)
+			}
+			err = x.Encode(exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = w.Replace(data, rows, act[d:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := d; j < d+p; j++ {
+				if !bytes.Equal(exp[j], act[j]) {
+					t.Fatalf("replace failed: vect: %d, rows: %v", j, rows)
+				}
+			}
+		}
+	}
+}
+
+func assertVectsEqual(t *testing.T, exp, act [][]byte, op string) {
+	t.Helper()
+
+	for i := range exp {
+		if !bytes.Equal(exp[i], act[i]) {
+			t.Fatalf("%s failed: vect %d mismatch", op, i)
+		}
+	}
+}
+
+func TestWorkspace_Allocs(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := x.NewWorkspace()
+		size := sub * 1024
+		vects := newShardMatrix(d+p, size)
+		r := newTestRand(t)
+		for j := 0; j < d; j++ {
+			fillRandom(t, r, vects[j])
+		}
+		newData := make([]byte, size)
+		dpHas := makeHasFromLost(d+p, []int{0, d + 1})
+		needReconst := []int{0, d + 1}
+		rows := []int{1, 3}
+
+		ops := map[string]func() error{
+			"encode":        func() error { return w.Encode(vects) },
+			"reconstOne":    func() error { return w.ReconstOne(vects, 1) },
+			"reconstParity": func() error { return w.ReconstParity(vects, d+1) },
+			"reconst":       func() error { return w.Reconst(vects, dpHas, needReconst) },
+			"preserve":      func() error { return w.ReconstPreserveInputs(vects, dpHas, needReconst) },
+			"update":        func() error { return w.Update(vects[2], newData, 2, vects[d:]) },
+			"replace":       func() error { return w.Replace(vects[:2], rows, vects[d:]) },
+			"updateMany":    func() error { return w.UpdateMany(vects[:2], vects[4:6], rows, vects[d:]) },
+		}
+		for name, op := range ops {
+			err = op() // Warm up.
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := testing.AllocsPerRun(16, func() {
+				_ = op()
+			})
+			if n != 0 {
+				t.Fatalf("%s allocates %.1f times; substripes: %d", name, n, sub)
+			}
+		}
+	}
+
+	// Reconst with piggyback for more than one lost data vector (see GetNeedVectsMulti).
+	x, err := New(10, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := x.NewWorkspace()
+	vects := newShardMatrix(16, 2048)
+	dpHas := makeHasFromLost(16, []int{0, 1})
+	needReconst := []int{0, 1}
+	err = w.Reconst(vects, dpHas, needReconst) // Warm up.
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := testing.AllocsPerRun(16, func() {
+		_ = w.Reconst(vects, dpHas, needReconst)
+	})
+	if n != 0 {
+		t.Fatalf("reconstMulti allocates %.1f times", n)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CheckXORSet checks whether set is a legal XORSet for dataNum+parityNum:
+// keys must be in [dataNum+1, dataNum+parityNum) (the first parity vector
+// can't carry XOR terms), and every data index must be in exactly one value.
+func CheckXORSet(dataNum, parityNum int, set map[int][]int) error {
+	d, p := dataNum, parityNum
+	seen := make([]bool, d)
+	cnt := 0
+	for k, v := range set {
+		if k <= d || k >= d+p {
+			return fmt.Errorf("%w: key: %d", ErrIllegalXORSet, k)
+		}
+		for _, i := range v {
+			if i < 0 || i >= d {
+				return fmt.Errorf("%w: data index: %d", ErrIllegalXORSet, i)
+			}
+			if seen[i] {
+				return fmt.Errorf("%w: duplicated data index: %d", ErrIllegalXORSet, i)
+			}
+			seen[i] = true
+			cnt++
+		}
+	}
+	if cnt != d {
+		for i, ok := range seen {
+			if !ok {
+				return fmt.Errorf("%w: missing data index: %d", ErrIllegalXORSet, i)
+			}
+		}
+	}
+	return nil
+}
+
+// copyXORSet returns a copy of set without empty entries,
+// values are sorted in ascending order (as makeXORSet does).
+func copyXORSet(set map[int][]int) map[int][]int {
+	m := make(map[int][]int, len(set))
+	for k, v := range set {
+		if len(v) == 0 {
+			continue
+		}
+		c := append([]int(nil), v...)
+		sort.Ints(c)
+		m[k] = c
+	}
+	return m
+}
+
+// equalXORSet reports whether a and b are the same.
+func equalXORSet(a, b map[int][]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, va := range a {
+		vb, ok := b[k]
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if va[i] != vb[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MakeXORSetWithPlacement makes an XORSet for dataNum+parityNum by placement,
+// which maps vector index to its failure domain label (e.g., rack, host or zone).
+// Every data index and parity index in [dataNum+1, dataNum+parityNum) must be in placement.
+//
+// ReconstOne of a data vector reads the parity vector keyed by its XORSet entry
+// and the other data vectors in the same entry, so the XORSet is made by grouping
+// data vectors with the parity vectors in the same failure domain as far as possible.
+// Every entry has no more than ceil(dataNum/(parityNum-1)) data indexes,
+// which keeps the repair cost bounded as makeXORSet does.
+//
+// The result could be passed to NewWithXORSet.
+func MakeXORSetWithPlacement(dataNum, parityNum int, placement map[int]string) (set map[int][]int, err error) {
+	d, p := dataNum, parityNum
+	if d <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrIllegalData, d)
+	}
+	if p < 2 {
+		return nil, fmt.Errorf("%w: %d", ErrIllegalParity, p)
+	}
+	for i := range placement {
+		if i < 0 || i >= d+p {
+			return nil, fmt.Errorf("%w: in placement: %d", ErrIllegalIndex, i)
+		}
+	}
+	for i := 0; i < d+p; i++ {
+		if i == d {
+			continue
+		}
+		if _, ok := placement[i]; !ok {
+			return nil, fmt.Errorf("%w: not in placement: %d", ErrIllegalIndex, i)
+		}
+	}
+
+	// Data vectors in bigger failure domains go first,
+	// so they could take the parity vectors nearby.
+	cnt := make(map[string]int)
+	data := make([]int, d)
+	for i := range data {
+		data[i] = i
+		cnt[placement[i]]++
+	}
+	sort.SliceStable(data, func(i, j int) bool {
+		li, lj := placement[data[i]], placement[data[j]]
+		if cnt[li] != cnt[lj] {
+			return cnt[li] > cnt[lj]
+		}
+		return li < lj
+	})
+
+	max := (d + p - 2) / (p - 1)
+	set = make(map[int][]int)
+	for _, t := range data {
+		lt := placement[t]
+		key, minCost := -1, 0
+		for k := d + 1; k < d+p; k++ {
+			if len(set[k]) >= max {
+				continue
+			}
+			// Cross-domain reads added by putting t into set[k]:
+			// t reads parity k and the others in set[k], and they read t.
+			cost := 0
+			if placement[k] != lt {
+				cost++
+			}
+			for _, u := range set[k] {
+				if placement[u] != lt {
+					cost += 2
+				}
+			}
+			if key == -1 || cost < minCost || (cost == minCost && len(set[k]) < len(set[key])) {
+				key, minCost = k, cost
+			}
+		}
+		set[key] = append(set[key], t)
+	}
+	for _, v := range set {
+		sort.Ints(v)
+	}
+	return set, nil
+}
@@ -0,0 +1,329 @@
+// Copyright (c) 2017 Temple3x (temple3x@gmail.com)
+//
+// Use of this source code is governed by the MIT License
+// that can be found in the LICENSE file.
+
+package xrs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCheckXORSet(t *testing.T) {
+	d, p := 4, 3
+
+	legal := []map[int][]int{
+		{5: {0, 1}, 6: {2, 3}},
+		{5: {0, 1, 2, 3}},
+		{5: {3, 0, 2}, 6: {1}},
+		{5: {0, 1, 2, 3}, 6: {}},
+	}
+	for i, set := range legal {
+		err := CheckXORSet(d, p, set)
+		if err != nil {
+			t.Fatalf("case %d should be legal: %s", i, err)
+		}
+	}
+
+	illegal := []map[int][]int{
+		nil,
+		{4: {0, 1}, 5: {2, 3}},     // First parity.
+		{5: {0, 1}, 7: {2, 3}},     // Out of parity range.
+		{3: {0, 1}, 5: {2, 3}},     // Data index as key.
+		{5: {0, 1}, 6: {1, 2, 3}},  // Duplicated.
+		{5: {0, 1, 1}, 6: {2, 3}},  // Duplicated in one value.
+		{5: {0, 1}, 6: {2}},        // Missing data.
+		{5: {0, 1}, 6: {2, 3, 4}},  // Out of data range.
+		{5: {-1, 0, 1}, 6: {2, 3}}, // Negative data index.
+	}
+	for i, set := range illegal {
+		if CheckXORSet(d, p, set) == nil {
+			t.Fatalf("case %d should be illegal", i)
+		}
+	}
+}
+
+func TestNewWithXORSet(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	set := map[int][]int{
+		d + 1: {9, 0, 3, 6},
+		d + 2: {1, 4, 7, 10, 2},
+		d + 3: {5, 8, 11},
+	}
+	x, err := NewWithXORSet(d, p, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing set after creating won't affect the codec.
+	set[d+1] = nil
+	if len(x.XORSet[d+1]) != 4 {
+		t.Fatal("XORSet should be copied")
+	}
+
+	exp := newShardMatrix(d+p, testShardSize)
+	for j := 0; j < d; j++ {
+		fillRandom(t, r, exp[j])
+	}
+	err = x.Encode(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := x.Verify(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("verify failed")
+	}
+
+	for lost := 0; lost < d; lost++ {
+		_, bNeed, err := x.GetNeedVects(lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, _ := x.xorKey(lost)
+		if bNeed[1] != key {
+			t.Fatalf("bNeed mismatch: %v, exp key: %d", bNeed, key)
+		}
+
+		act := newShardMatrix(d+p, testShardSize)
+		for j := range act {
+			if j != lost {
+				copy(act[j], exp[j])
+			}
+		}
+		err = x.ReconstOne(act, lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(act[lost], exp[lost]) {
+			t.Fatalf("mismatch reconstOne; vect: %d", lost)
+		}
+	}
+
+	for i := 0; i < 32; i++ {
+		lost := makeLostRandom(r, d+p, 1+r.Intn(p))
+		dpHas := makeHasFromLost(d+p, lost)
+		act := newShardMatrix(d+p, testShardSize)
+		for _, h := range dpHas {
+			copy(act[h], exp[h])
+		}
+		err = x.Reconst(act, dpHas, lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range lost {
+			if !bytes.Equal(act[n], exp[n]) {
+				t.Fatalf("reconst failed: vect: %d, lost: %v", n, lost)
+			}
+		}
+	}
+}
+
+func TestNewWithXORSetIllegal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+
+	_, err := NewWithXORSet(d, p, nil)
+	if err == nil {
+		t.Fatal("nil XORSet should be illegal")
+	}
+	_, err = NewWithXORSet(d, p, map[int][]int{d: {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}})
+	if err == nil {
+		t.Fatal("XORSet on first parity should be illegal")
+	}
+}
+
+// XORSet and Substripes assigned by the caller are checked before being used.
+func TestXRS_ChangedXORSet(t *testing.T) {
+	d, p := 4, 3
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vects := newShardMatrix(d+p, 64)
+	err = x.Encode(vects)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := map[string]func() error{
+		"Encode":        func() error { return x.Encode(vects) },
+		"ReconstOne":    func() error { return x.ReconstOne(vects, 0) },
+		"ReconstParity": func() error { return x.ReconstParity(vects, d+1) },
+		"Reconst":       func() error { return x.Reconst(vects, []int{1, 2, 3, 4}, []int{0}) },
+		"Update":        func() error { return x.Update(vects[0], vects[0], 0, vects[d:]) },
+		"Replace":       func() error { return x.Replace(vects[:1], []int{0}, vects[d:]) },
+		"EncodeRange":   func() error { return x.EncodeRange(vects, 0, 8) },
+		"UpdateRange":   func() error { return x.UpdateRange(vects[0][:8], vects[0][:8], 0, 0, vects[d:]) },
+		"GetNeedVects": func() error {
+			_, _, err := x.GetNeedVects(0)
+			return err
+		},
+		"RepairPlanRange": func() error {
+			_, err := x.RepairPlanRange(0, 64, 0, 8)
+			return err
+		},
+		"PlanReconst": func() error {
+			_, err := x.PlanReconst([]int{0, 1}, []int{0, 1})
+			return err
+		},
+		"Verify": func() error {
+			_, err := x.Verify(vects)
+			return err
+		},
+	}
+	sets := []map[int][]int{
+		{d: {0, 1}, d + 2: {2, 3}},     // First parity.
+		{d + 1: {0, 1}, d + 2: {2}},    // Missing data.
+		{d + 1: {0, 1}, d + 2: {1, 3}}, // Duplicated.
+	}
+	for i, set := range sets {
+		x.XORSet = set
+		for name, f := range fs {
+			if err = f(); !errors.Is(err, ErrIllegalXORSet) {
+				t.Fatalf("case %d %s: mismatch error: %v, exp: %v", i, name, err, ErrIllegalXORSet)
+			}
+		}
+	}
+
+	// Changed in place after being used.
+	x.XORSet = map[int][]int{d + 1: {0, 1}, d + 2: {2, 3}}
+	err = x.Encode(vects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.XORSet[d+2] = x.XORSet[d+2][:1]
+	err = x.Encode(vects)
+	if !errors.Is(err, ErrIllegalXORSet) {
+		t.Fatalf("mismatch error: %v, exp: %v", err, ErrIllegalXORSet)
+	}
+
+	x.XORSet = map[int][]int{d + 1: {0, 1}, d + 2: {2, 3}}
+	x.Substripes = p + 1
+	err = x.Encode(vects)
+	if !errors.Is(err, ErrIllegalSubstripes) {
+		t.Fatalf("mismatch error: %v, exp: %v", err, ErrIllegalSubstripes)
+	}
+}
+
+func TestMakeXORSetWithPlacement(t *testing.T) {
+	d, p := testDataShards, testParityShards
+
+	// 4 racks, rack i has data [3i, 3i+3) and parity d+i.
+	placement := make(map[int]string)
+	racks := []string{"r0", "r1", "r2", "r3"}
+	for i := 0; i < d; i++ {
+		placement[i] = racks[i/3]
+	}
+	for i := 0; i < p; i++ {
+		placement[d+i] = racks[i]
+	}
+
+	set, err := MakeXORSetWithPlacement(d, p, placement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckXORSet(d, p, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	max := (d + p - 2) / (p - 1)
+	for k, v := range set {
+		if len(v) > max {
+			t.Fatalf("too many data in XORSet[%d]: %v", k, v)
+		}
+	}
+	for i := 1; i < p; i++ {
+		for _, j := range []int{3 * i, 3*i + 1, 3*i + 2} {
+			if !isIn(j, set[d+i]) {
+				t.Fatalf("data %d should be in XORSet[%d]: %v", j, d+i, set)
+			}
+		}
+	}
+
+	rr := make(map[int][]int)
+	makeXORSet(d, p, rr)
+	if act, rrc := crossReads(set, placement), crossReads(rr, placement); act >= rrc {
+		t.Fatalf("cross-rack reads should be less than round-robin: %d, round-robin: %d", act, rrc)
+	}
+
+	// Works with codec.
+	_, err = NewWithXORSet(d, p, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// All in one rack.
+	for i := range placement {
+		placement[i] = "r0"
+	}
+	set, err = MakeXORSetWithPlacement(d, p, placement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckXORSet(d, p, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := crossReads(set, placement); c != 0 {
+		t.Fatalf("cross-rack reads mismatch: %d, exp: 0", c)
+	}
+}
+
+func TestMakeXORSetWithPlacementIllegal(t *testing.T) {
+	d, p := 4, 3
+	full := map[int]string{0: "a", 1: "a", 2: "b", 3: "b", 5: "a", 6: "b"}
+
+	_, err := MakeXORSetWithPlacement(d, p, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = MakeXORSetWithPlacement(d, 1, map[int]string{0: "a", 1: "a", 2: "b", 3: "b"})
+	if err == nil {
+		t.Fatal("parity 1 should be illegal")
+	}
+	_, err = MakeXORSetWithPlacement(0, p, full)
+	if err == nil {
+		t.Fatal("data 0 should be illegal")
+	}
+	for _, i := range []int{0, 5} {
+		pl := make(map[int]string)
+		for k, v := range full {
+			pl[k] = v
+		}
+		delete(pl, i)
+		_, err = MakeXORSetWithPlacement(d, p, pl)
+		if err == nil {
+			t.Fatalf("missing index %d should be illegal", i)
+		}
+	}
+	full[d+p] = "a"
+	_, err = MakeXORSetWithPlacement(d, p, full)
+	if err == nil {
+		t.Fatal("index out of range should be illegal")
+	}
+}
+
+// crossReads returns the number of cross-domain vectors read by ReconstOne
+// (besides the ones read anyway) summed over all data vectors.
+func crossReads(set map[int][]int, placement map[int]string) int {
+	n := 0
+	for k, v := range set {
+		for _, t := range v {
+			if placement[k] != placement[t] {
+				n++
+			}
+			for _, u := range v {
+				if u != t && placement[u] != placement[t] {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
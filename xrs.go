@@ -7,7 +7,8 @@
 // "A Hitchhiker's Guide to Fast and Efficient Data Reconstruction in
 // Erasure-coded Data Centers".
 //
-// XRS splits each row vector into two equal-sized parts.
+// XRS splits each row vector into Substripes equal-sized parts
+// (two by default, named a and b).
 // Example: 10+4:
 // +---------+
 // | a1 | b1 |
@@ -28,11 +29,20 @@
 // +---------+
 // | a13| b13|
 // +---------+
+//
+// The last part of some parity vectors carries the XOR of other parts of data
+// vectors (see XORSet), so a single lost data vector can be reconstructed
+// by reading fewer bytes than Reed-Solomon needs. With more sub-stripes
+// (see NewWithSubstripes), every part but the last one of a data vector is
+// carried by a different parity vector, which reduces the I/O further
+// when ParityNum is large enough.
 package xrs
 
 import (
-	"errors"
 	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
 
 	rs "github.com/templexxx/reedsolomon"
 	xor "github.com/templexxx/xorsimd"
@@ -46,24 +56,96 @@ type XRS struct {
 	//
 	// Key: parity index (excluding the first parity shard).
 	// Value: data indexes.
+	//
+	// The first sub-stripe of the data vectors is XOR-ed into the last
+	// sub-stripe of the key. With more than two sub-stripes, sub-stripe s
+	// goes to the parity s indexes after the key
+	// (wrapping around within [DataNum+1, DataNum+ParityNum)).
 	XORSet map[int][]int
+	// Substripes is the number of equal-sized parts each vector is split into.
+	// 0 means 2, so an XRS made by a literal with only RS and XORSet works
+	// as before.
+	Substripes int
+
+	// XORSet and Substripes could be changed by the caller,
+	// they're checked before being used (see CheckXORSet),
+	// and methods return ErrIllegalXORSet or ErrIllegalSubstripes
+	// if they're illegal.
+	lay atomic.Value // *layout
 }
 
 // New creates an XRS codec with the given data and parity shard counts.
+// Each vector is split into two halves.
 //
-// parityNum cannot be 1.
+// If parityNum is 1, there is no parity vector to carry XOR terms,
+// the XORSet is empty and the codec works as plain Reed-Solomon (XOR parity):
+// ReconstOne reads all the other vectors (see GetNeedVects).
 func New(dataNum, parityNum int) (x *XRS, err error) {
-	if parityNum == 1 {
-		err = errors.New("illegal parity")
+	return NewWithSubstripes(dataNum, parityNum, 2)
+}
+
+// NewWithSubstripes creates an XRS codec which splits each vector into
+// substripes equal-sized parts.
+//
+// substripes must be in [2, parityNum] (or 2 if parityNum is 1).
+// Reconstructing a single data vector reads about
+// (DataNum + (substripes-1)*(substripes-1)*DataNum/(parityNum-1)) / substripes
+// vectors, so the best choice is close to sqrt(parityNum).
+// NewWithSubstripes(d, p, 2) is as same as New(d, p).
+func NewWithSubstripes(dataNum, parityNum, substripes int) (x *XRS, err error) {
+	return newXRS(dataNum, parityNum, substripes, nil)
+}
+
+// NewWithXORSet creates an XRS codec with a custom XORSet
+// (e.g., data vectors sharing a parity vector live in different failure domains).
+// Each vector is split into two halves.
+//
+// Keys of set must be in [dataNum+1, dataNum+parityNum),
+// and every data index must be in exactly one value.
+// set is copied, so changing it later won't affect the codec.
+func NewWithXORSet(dataNum, parityNum int, set map[int][]int) (x *XRS, err error) {
+	if set == nil {
+		err = fmt.Errorf("%w: nil", ErrIllegalXORSet)
+		return
+	}
+	return newXRS(dataNum, parityNum, 2, set)
+}
+
+// newXRS creates an XRS codec, makeXORSet is used if set is nil.
+func newXRS(dataNum, parityNum, substripes int, set map[int][]int) (x *XRS, err error) {
+	if dataNum <= 0 {
+		err = fmt.Errorf("%w: %d", ErrIllegalData, dataNum)
+		return
+	}
+	if parityNum <= 0 {
+		err = fmt.Errorf("%w: %d", ErrIllegalParity, parityNum)
 		return
 	}
 	r, err := rs.New(dataNum, parityNum)
+	if err != nil {
+		err = wrapRS(err)
+		return
+	}
+	err = checkSubstripes(parityNum, substripes)
 	if err != nil {
 		return
 	}
-	xs := make(map[int][]int)
-	makeXORSet(dataNum, parityNum, xs)
-	x = &XRS{RS: r, XORSet: xs}
+	var xs map[int][]int
+	if set == nil {
+		xs = make(map[int][]int)
+		makeXORSet(dataNum, parityNum, xs)
+	} else {
+		err = CheckXORSet(dataNum, parityNum, set)
+		if err != nil {
+			return
+		}
+		xs = copyXORSet(set)
+	}
+	x = &XRS{RS: r, XORSet: xs, Substripes: substripes}
+	err = x.checkLayout()
+	if err != nil {
+		return nil, err
+	}
 	return
 }
 
@@ -75,6 +157,9 @@ func New(dataNum, parityNum int) (x *XRS, err error) {
 // b12 ⊕ a1 ⊕ a4 ⊕ a7 = new_b12
 // b13 ⊕ a2 ⊕ a5 ⊕ a8 = new_b13
 func makeXORSet(d, p int, m map[int][]int) {
+	if p < 2 { // No parity vector carries XOR terms.
+		return
+	}
 
 	// Initialize map.
 	for i := d + 1; i < d+p; i++ {
@@ -101,40 +186,185 @@ func makeXORSet(d, p int, m map[int][]int) {
 
 // Encode encodes data and writes parity vectors into vects[r.DataNum:].
 func (x *XRS) Encode(vects [][]byte) (err error) {
-
-	err = checkSize(vects[0])
+	w, err := x.borrow()
 	if err != nil {
 		return
 	}
-	size := len(vects[0])
+	defer w.release()
+	return w.Encode(vects)
+}
 
-	// Step 1: Reed-Solomon encode.
-	err = x.RS.Encode(vects)
+// EncodeConcurrent is as same as Encode, but it splits each sub-stripe
+// into workers parts and encodes them in parallel.
+// The result is identical to Encode.
+//
+// It's helpful for big vectors (e.g., >= 1MB),
+// each part is still encoded in cache-friendly pieces by the backend.
+// If workers <= 0, runtime.GOMAXPROCS(0) is used.
+func (x *XRS) EncodeConcurrent(vects [][]byte, workers int) (err error) {
+
+	err = x.checkVects(vects)
 	if err != nil {
 		return
 	}
 
-	// Step 2: XOR based on XORSet.
-	half := size / 2
-	for bi, xs := range x.XORSet {
-		xv := make([][]byte, len(xs)+1)
-		xv[0] = vects[bi][half:]
-		for j, ai := range xs {
-			xv[j+1] = vects[ai][:half]
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	n := len(vects[0]) / x.substripes()
+	if parts := (n + minEncodePart - 1) / minEncodePart; workers > parts {
+		workers = parts // Each worker has one part at least.
+	}
+	part := (n + workers - 1) / workers
+	part = (part + minEncodePart - 1) / minEncodePart * minEncodePart
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for lo := 0; lo < n; lo += part {
+		hi := lo + part
+		if hi > n {
+			hi = n
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			err2 := x.encodePart(vects, lo, hi)
+			if err2 != nil {
+				errs <- err2
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// minEncodePart is the minimum part size of EncodeConcurrent,
+// it's a multiple of cache line size.
+const minEncodePart = 4 * 1024
+
+// encodePart encodes bytes [lo, hi) of every sub-stripe.
+func (x *XRS) encodePart(vects [][]byte, lo, hi int) (err error) {
+
+	// Step 1: Reed-Solomon encode.
+	tmp := make([][]byte, len(vects))
+	for s := 0; s < x.substripes(); s++ {
+		for i, v := range vects {
+			tmp[i] = x.sub(v, s)[lo:hi]
 		}
-		xor.Encode(vects[bi][half:], xv)
+		err = x.RS.Encode(tmp)
+		if err != nil {
+			return wrapRS(err)
+		}
+	}
+
+	// Step 2: XOR based on XORSet.
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	last := x.substripes() - 1
+	for i := d + 1; i < d+p; i++ {
+		x.xorTermsInto(x.sub(vects[i], last)[lo:hi], vects, i, lo)
 	}
 	return
 }
 
-func checkSize(vect []byte) error {
-	size := len(vect)
-	if size&1 != 0 {
-		return fmt.Errorf("vect size not even: %d", size)
+// substripes returns Substripes, 0 is treated as 2.
+func (x *XRS) substripes() int {
+	if x.Substripes == 0 {
+		return 2
+	}
+	return x.Substripes
+}
+
+func (x *XRS) checkSize(size int) error {
+	if size%x.substripes() != 0 {
+		return fmt.Errorf("%w: not a multiple of %d: %d", ErrOddVectSize, x.substripes(), size)
 	}
 	return nil
 }
 
+// sub returns the s-th sub-stripe of vect.
+func (x *XRS) sub(vect []byte, s int) []byte {
+	n := len(vect) / x.substripes()
+	return vect[s*n : s*n+n]
+}
+
+// slot returns the parity index whose last sub-stripe carries
+// sub-stripe s of the data vectors in XORSet[key],
+// it returns false if key is not in [DataNum+1, DataNum+ParityNum).
+//
+// s may be negative, it's used for finding the key by a parity index.
+func (x *XRS) slot(key, s int) (p int, ok bool) {
+	d, q := x.RS.DataNum, x.RS.ParityNum-1
+	if key <= d || key > d+q {
+		return 0, false
+	}
+	return d + 1 + ((key-d-1+s)%q+q)%q, true
+}
+
+// xorKey returns the XORSet key which contains data index i,
+// it returns false if there is no such key or the key is out of range.
+func (x *XRS) xorKey(i int) (key int, ok bool) {
+	for k, s := range x.XORSet {
+		if isIn(i, s) {
+			_, ok = x.slot(k, 0)
+			return k, ok
+		}
+	}
+	return 0, false
+}
+
+// term is a sub-stripe of a data vector.
+type term struct {
+	index int
+	sub   int
+}
+
+// terms returns the data sub-stripes which are XOR-ed into
+// the last sub-stripe of parity vector p.
+// They're made once by checkLayout, don't modify them.
+func (x *XRS) terms(p int) []term {
+	if p <= x.RS.DataNum { // The first parity has no XOR terms.
+		return nil
+	}
+	return x.layout().terms[p-x.RS.DataNum]
+}
+
+// makeTerms makes terms(p) by XORSet.
+func (x *XRS) makeTerms(p int) []term {
+	if p <= x.RS.DataNum {
+		return nil
+	}
+	var ts []term
+	for s := 0; s < x.substripes()-1; s++ {
+		key, _ := x.slot(p, -s)
+		for _, i := range x.XORSet[key] {
+			ts = append(ts, term{index: i, sub: s})
+		}
+	}
+	return ts
+}
+
+// xorTerms XORs terms(p) into the last sub-stripe of vects[p].
+// It's an involution, so it also converts vects[p] back to RS form.
+func (x *XRS) xorTerms(vects [][]byte, p int) {
+	x.xorTermsInto(x.sub(vects[p], x.substripes()-1), vects, p, 0)
+}
+
+// xorTermsInto XORs terms(p) (taken from vects) into b.
+// The terms are taken from offset off of each sub-stripe.
+func (x *XRS) xorTermsInto(b []byte, vects [][]byte, p, off int) {
+	ts := x.terms(p)
+	if len(ts) == 0 {
+		return
+	}
+	xv := make([][]byte, len(ts)+1)
+	xv[0] = b
+	for j, t := range ts {
+		xv[j+1] = x.sub(vects[t.index], t.sub)[off : off+len(b)]
+	}
+	xor.Encode(b, xv)
+}
+
 // GetNeedVects takes needReconst (which must be a data index) and returns:
 // 1) a-vector indexes
 // 2) b-parity-vector indexes
@@ -142,207 +372,401 @@ func checkSize(vect []byte) error {
 //
 // It is used by ReconstOne to reduce reconstruction I/O.
 //
-// bNeed always has two elements, and the first is DataNum.
+// bNeed always has Substripes elements, and the first is DataNum.
+// The last sub-stripe of bNeed and of the other data vectors is needed,
+// and for aNeed only the sub-stripes XOR-ed into bNeed[1:] are needed
+// (with two sub-stripes, that's the a-half).
+//
+// If ParityNum is 1, there is no XOR term: bNeed is [DataNum] and aNeed has
+// the other data vectors and DataNum, which means all of them must be read.
 func (x *XRS) GetNeedVects(needReconst int) (aNeed, bNeed []int, err error) {
 	d := x.RS.DataNum
 	if needReconst < 0 || needReconst >= d {
-		err = fmt.Errorf("illegal data index: %d", needReconst)
+		err = fmt.Errorf("%w: not a data index: %d", ErrIllegalIndex, needReconst)
+		return
+	}
+	err = x.checkLayout()
+	if err != nil {
 		return
 	}
 
-	// Find b.
-	bNeed = make([]int, 2)
-	bNeed[0] = d // Must have b_vects[d].
-	xs := x.XORSet
-	for i, s := range xs {
-		if isIn(needReconst, s) {
-			bNeed[1] = i
-			break
+	if x.RS.ParityNum == 1 {
+		aNeed = make([]int, 0, d)
+		for i := 0; i <= d; i++ {
+			if i != needReconst {
+				aNeed = append(aNeed, i)
+			}
 		}
+		return aNeed, x.makeBNeed(needReconst), nil
 	}
 
+	bNeed = append([]int(nil), x.layout().bNeed[needReconst]...)
+
 	// Get a (excluding needReconst).
-	for _, i := range xs[bNeed[1]] {
-		if i != needReconst {
-			aNeed = append(aNeed, i)
+	for _, p := range bNeed[1:] {
+		for _, t := range x.terms(p) {
+			if t.index != needReconst && !isIn(t.index, aNeed) {
+				aNeed = append(aNeed, t.index)
+			}
 		}
 	}
 	return
 }
 
+// makeBNeed makes bNeed of GetNeedVects(i) by XORSet, which has been checked.
+func (x *XRS) makeBNeed(i int) []int {
+	d := x.RS.DataNum
+	if x.RS.ParityNum == 1 {
+		return []int{d}
+	}
+	key, _ := x.xorKey(i)
+	bNeed := make([]int, x.substripes())
+	bNeed[0] = d // Must have b_vects[d].
+	for s := 1; s < x.substripes(); s++ {
+		bNeed[s], _ = x.slot(key, s-1)
+	}
+	return bNeed
+}
+
 // ReconstOne reconstructs a single data vector with reduced I/O.
 // Ensure required vectors are available (see GetNeedVects).
 func (x *XRS) ReconstOne(vects [][]byte, needReconst int) (err error) {
-
-	err = checkSize(vects[0])
+	w, err := x.borrow()
 	if err != nil {
 		return
 	}
+	defer w.release()
+	return w.ReconstOne(vects, needReconst)
+}
 
-	aNeed, bNeed, err := x.GetNeedVects(needReconst)
+// ReconstOneSparse is as same as ReconstOne,
+// but it only takes the sub-stripes which are needed (see RepairPlan).
+//
+// parts[i][s] is sub-stripe s of vector i (with two sub-stripes,
+// parts[i][0] is the a-half and parts[i][1] is the b-half).
+// Vectors and sub-stripes which are not needed could be missing or nil.
+// The reconstructed vector is written into dst,
+// whose size must be Substripes times the size of a sub-stripe.
+func (x *XRS) ReconstOneSparse(parts map[int][][]byte, needReconst int, dst []byte) (err error) {
+
+	if len(dst) == 0 {
+		return fmt.Errorf("%w: %d", ErrOddVectSize, len(dst))
+	}
+	err = x.checkSize(len(dst))
 	if err != nil {
 		return
 	}
 
-	// Step 1: Reconstruct b_needReconst and rs(bNeed[1]) using Reed-Solomon.
-	bVects := make([][]byte, len(vects))
-	half := len(vects[0]) / 2
-	for i, v := range vects {
-		bVects[i] = v[half:]
+	need, err := x.needSubs(needReconst)
+	if err != nil {
+		return
 	}
-
-	d := x.RS.DataNum
-	bDPHas := make([]int, d)
-	for i := 0; i < d; i++ {
-		bDPHas[i] = i
+	n := len(dst) / x.substripes()
+	ps := make([][][]byte, len(need))
+	for i, subs := range need {
+		for s, ok := range subs {
+			if !ok {
+				continue
+			}
+			if s >= len(parts[i]) || parts[i][s] == nil {
+				return fmt.Errorf("%w: missing sub-stripe %d of vect %d", ErrTooFewShards, s, i)
+			}
+			if len(parts[i][s]) != n {
+				return fmt.Errorf("%w: sub-stripe %d of vect %d has %d bytes, want %d", ErrShardSizeMismatch, s, i, len(parts[i][s]), n)
+			}
+			if ps[i] == nil {
+				ps[i] = make([][]byte, x.substripes())
+			}
+			ps[i][s] = parts[i][s]
+		}
 	}
-	bDPHas[needReconst] = d // Replace needReconst with DataNum.
+	w, err := x.borrow()
+	if err != nil {
+		return
+	}
+	defer w.release()
+	return w.reconstOne(ps, needReconst, x.subs(dst))
+}
 
-	bi := bNeed[1] // B index in XORSet.
+// subs splits vect into sub-stripes.
+func (x *XRS) subs(vect []byte) [][]byte {
+	subs := make([][]byte, x.substripes())
+	for s := range subs {
+		subs[s] = x.sub(vect, s)
+	}
+	return subs
+}
 
-	bRS := make([]byte, half)
-	bVects[bi] = bRS
-	err = x.RS.Reconst(bVects, bDPHas, []int{needReconst, bi})
-	if err != nil {
+// GetNeedVectsParity takes needReconst (which must be a parity index) and returns:
+// 1) a-vector indexes
+// 2) b-vector indexes
+// required to reconstruct needReconst.
+//
+// It is used by ReconstParity.
+//
+// Every sub-stripe of a parity vector is a Reed-Solomon combination of
+// the same sub-stripe of all data vectors, so DataNum vectors must be read
+// whatever XORSet is: both aNeed and bNeed are [0, DataNum),
+// and the a-vectors also provide the XOR terms of needReconst.
+// The saving is that no other parity vector is read (or modified),
+// which is what Reconst has to do for converting them back to RS form.
+func (x *XRS) GetNeedVectsParity(needReconst int) (aNeed, bNeed []int, err error) {
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	if needReconst < d || needReconst >= d+p {
+		err = fmt.Errorf("%w: not a parity index: %d", ErrIllegalIndex, needReconst)
 		return
 	}
 
-	// Step 2: Reconstruct a_needReconst.
-	// ∵ a_needReconst ⊕ a_need ⊕ bRS = vects[bi]
-	// ∴ a_needReconst = vects[bi] ⊕ bRS ⊕ a_need
-	xorV := make([][]byte, len(aNeed)+2)
-	xorV[0] = vects[bi][half:]
-	xorV[1] = bRS
-	for i, ai := range aNeed {
-		xorV[i+2] = vects[ai][:half]
+	aNeed, bNeed = make([]int, d), make([]int, d)
+	for i := 0; i < d; i++ {
+		aNeed[i], bNeed[i] = i, i
 	}
-	xor.Encode(vects[needReconst][:half], xorV)
 	return
 }
 
+// ReconstParity reconstructs a single parity vector.
+// Ensure required vectors are available (see GetNeedVectsParity).
+//
+// All data vectors are read in full, which is the same read set as
+// Reed-Solomon with dpHas = [0, DataNum).
+// The only gain over Reconst is that other parity vectors are
+// neither read nor modified.
+func (x *XRS) ReconstParity(vects [][]byte, needReconst int) (err error) {
+	w, err := x.borrow()
+	if err != nil {
+		return
+	}
+	defer w.release()
+	return w.ReconstParity(vects, needReconst)
+}
+
 // Reconst reconstructs missing vectors.
 // vects: All vectors, len(vects) = dataNum + parityNum.
 // dpHas: Survived data and parity index, need dataNum indexes at least.
 // needReconst: Vectors indexes which need to be reconstructed.
 //
-// If there is exactly one missing data vector, Reconst calls ReconstOne.
-// In that case, ensure the required vectors in vects are valid.
+// If there is exactly one data vector needs to be reconstructed and
+// dpHas has all vectors required by it (see GetNeedVects), Reconst calls ReconstOne.
+// If there is exactly one parity vector needs to be reconstructed and
+// all data vectors are in dpHas, Reconst calls ReconstParity.
+// If needReconst are all the lost data vectors and piggyback reads less
+// than Reed-Solomon (see GetNeedVectsMulti), Reconst calls ReconstMulti.
 //
 // Example:
 // in 3+2, the whole index: [0,1,2,3,4],
 // if vects[0,4] are lost and both need reconstruction,
 // dpHas should be [1,2,3], and vects[1], vects[2], vects[3] must be valid.
 // Reconstructed results are written back to vects[0] and vects[4] directly.
+//
+// Reconstructing in general has to convert the parity vectors in dpHas
+// (except DataNum) back to RS form, so after Reconst returns nil,
+// they may be left in RS form and not be valid XRS vectors anymore
+// (which ones is unspecified, it depends on the path taken).
+// Use ReconstPreserveInputs if vects will be used again.
+// If Reconst returns an error, vectors in dpHas are unmodified
+// (vectors not in dpHas may have been partly written).
 func (x *XRS) Reconst(vects [][]byte, dpHas, needReconst []int) (err error) {
-
-	if len(needReconst) == 1 && needReconst[0] < x.RS.DataNum {
-		return x.ReconstOne(vects, needReconst[0])
+	w, err := x.borrow()
+	if err != nil {
+		return
 	}
+	defer w.release()
+	return w.Reconst(vects, dpHas, needReconst)
+}
 
-	err = checkSize(vects[0])
+// ReconstPreserveInputs is as same as Reconst,
+// but vectors in dpHas are always unmodified when it returns,
+// so every vector in dpHas and needReconst is a valid XRS vector.
+// (Vectors neither in dpHas nor in needReconst may have been partly written.)
+//
+// It costs an extra XOR pass over the last sub-stripe of
+// the parity vectors in dpHas when Reconst has to convert them.
+func (x *XRS) ReconstPreserveInputs(vects [][]byte, dpHas, needReconst []int) (err error) {
+	w, err := x.borrow()
 	if err != nil {
 		return
 	}
+	defer w.release()
+	return w.ReconstPreserveInputs(vects, dpHas, needReconst)
+}
 
-	// Step 1: Reconstruct all a-vectors.
-	half := len(vects[0]) / 2
-	aVects := make([][]byte, len(vects))
-	for i := range vects {
-		aVects[i] = vects[i][:half]
+// hasForOne reports whether dpHas has all vectors required by
+// ReconstOne(needReconst), bNeed is returned by GetNeedVects.
+func (x *XRS) hasForOne(dpHas, bNeed []int, needReconst int) bool {
+	for i := 0; i < x.RS.DataNum; i++ {
+		if i != needReconst && !isIn(i, dpHas) {
+			return false
+		}
 	}
-	aLost := make([]int, 0)
-	for i := 0; i < x.RS.DataNum+x.RS.ParityNum; i++ {
+	for _, i := range bNeed {
 		if !isIn(i, dpHas) {
-			aLost = append(aLost, i)
+			return false
 		}
 	}
-	err = x.RS.Reconst(aVects, dpHas, aLost)
-	if err != nil {
-		return
-	}
+	return true
+}
 
-	// Step 2: Convert available b-vectors back to RS form when needed.
-	err = x.retrieveRS(vects, dpHas)
-	if err != nil {
-		return
+// isLostData returns true if needReconst are exactly the data vectors
+// not in dpHas.
+func (x *XRS) isLostData(dpHas, needReconst []int) bool {
+	for _, i := range needReconst {
+		if i >= x.RS.DataNum {
+			return false
+		}
+	}
+	for i := 0; i < x.RS.DataNum; i++ {
+		if !isIn(i, dpHas) && !isIn(i, needReconst) {
+			return false
+		}
 	}
+	return true
+}
 
-	// Step 3: Reconstruct b-vectors using RS codes.
-	bVects := make([][]byte, len(vects))
-	for i := range vects {
-		bVects[i] = vects[i][half:]
+// lost returns the vectors not in dpHas.
+func (x *XRS) lost(dpHas []int) []int {
+	var lost []int
+	for i := 0; i < x.RS.DataNum+x.RS.ParityNum; i++ {
+		if !isIn(i, dpHas) {
+			lost = append(lost, i)
+		}
 	}
-	err = x.RS.Reconst(bVects, dpHas, needReconst)
-	if err != nil {
-		return
+	return lost
+}
+
+func (x *XRS) hasAllData(dpHas []int) bool {
+	for i := 0; i < x.RS.DataNum; i++ {
+		if !isIn(i, dpHas) {
+			return false
+		}
 	}
+	return true
+}
 
-	// Step 4: Apply XOR to b-parity-vectors according to XORSet when needed.
+// appendANeed appends the vectors whose a-vectors must be reconstructed
+// by Reconst to dst: needReconst, and the lost data vectors which are
+// XOR terms of the parity vectors in dpHas (for converting them back to
+// RS form) or in needReconst (for applying XOR to them).
+func (x *XRS) appendANeed(dst []int, dpHas, needReconst []int) []int {
 	d := x.RS.DataNum
-	_, pn := rs.SplitNeedReconst(d, needReconst)
-	if len(pn) != 0 {
-		if len(pn) == 1 && pn[0] == d {
-			return nil
-		}
-		for _, i := range pn {
-			if i != d {
-				xs := x.XORSet[i]
-				xv := make([][]byte, len(xs)+1)
-				xv[0] = vects[i][half:]
-				for j, ai := range xs {
-					xv[j+1] = vects[ai][:half]
+	dst = append(dst, needReconst...)
+	for _, ps := range [2][]int{dpHas, needReconst} {
+		for _, p := range ps {
+			if p <= d {
+				continue
+			}
+			for _, t := range x.terms(p) {
+				if !isIn(t.index, dpHas) && !isIn(t.index, dst) {
+					dst = append(dst, t.index)
 				}
-				xor.Encode(vects[i][half:], xv)
 			}
 		}
 	}
-
-	return nil
+	return dst
 }
 
-// retrieveRS converts available b-parity-vectors back to RS form
-// by XOR-ing with the corresponding a-vectors defined in XORSet.
-func (x *XRS) retrieveRS(vects [][]byte, dpHas []int) (err error) {
+// decodeKey is the bitmaps of available (first DataNum) and
+// needed vector indexes.
+type decodeKey struct {
+	has, need [4]uint64
+}
 
-	half := len(vects[0]) / 2
-	for _, h := range dpHas {
-		if h > x.RS.DataNum { // vects[data] is rs_codes
-			xs := x.XORSet[h]
-			xv := make([][]byte, len(xs)+1)
-			xv[0] = vects[h][half:] // put B first
-			for i, ai := range xs {
-				xv[i+1] = vects[ai][:half]
-			}
-			xor.Encode(vects[h][half:], xv)
+// decoder returns the codec which makes vects[need] from vects[has],
+// has has DataNum indexes and both are in ascending order.
+//
+// Codecs are made on the first use of each (has, need) and kept in
+// the layout, as the backend keeps its inverse matrices.
+func (x *XRS) decoder(has, need []int) (r *rs.RS, err error) {
+
+	n := x.RS.DataNum + x.RS.ParityNum
+	var key decodeKey
+	for _, i := range has {
+		if i < 0 || i >= n {
+			return nil, fmt.Errorf("%w: %d", ErrIllegalIndex, i)
 		}
+		key.has[i>>6] |= 1 << uint(i&63)
 	}
+	for _, i := range need {
+		if i < 0 || i >= n {
+			return nil, fmt.Errorf("%w: %d", ErrIllegalIndex, i)
+		}
+		key.need[i>>6] |= 1 << uint(i&63)
+	}
+	l := x.layout()
+	v, ok := l.decoders.Load(key)
+	if ok {
+		return v.(*rs.RS), nil
+	}
+
+	r, err = x.makeDecoder(has, need)
+	if err != nil {
+		return
+	}
+	l.decoders.Store(key, r)
 	return
 }
 
-// Update updates parity data when one data vector changes.
-// row is the index of the updated data vector in the full set.
-func (x *XRS) Update(oldData, newData []byte, row int, parity [][]byte) (err error) {
-
-	err = checkSize(oldData)
+// makeDecoder returns the codec which makes vects[need] from vects[has],
+// has has DataNum indexes in ascending order.
+//
+// Reconstruction is linear, so the matrix is found by reconstructing
+// DataNum-byte vectors where the j-th available one is 1 at byte j.
+func (x *XRS) makeDecoder(has, need []int) (r *rs.RS, err error) {
+	d, p := x.RS.DataNum, x.RS.ParityNum
+	probe := make([][]byte, d+p)
+	for i := range probe {
+		probe[i] = make([]byte, d)
+	}
+	for j, i := range has {
+		probe[i][j] = 1
+	}
+	err = x.RS.Reconst(probe, append([]int(nil), has...), append([]int(nil), need...))
 	if err != nil {
-		return
+		return nil, wrapRS(err)
+	}
+
+	gm := make([]byte, len(need)*d)
+	for j, i := range need {
+		copy(gm[j*d:j*d+d], probe[i])
 	}
+	return x.codec(d, gm), nil
+}
+
+// codec returns the codec which multiplies rows vectors by gm
+// (len(gm)/rows rows, rows columns), only its Encode could be used.
+//
+// It's a copy of x.RS with another generator matrix,
+// so there is no encoding matrix to make as rs.New does.
+func (x *XRS) codec(rows int, gm []byte) *rs.RS {
+	r := new(rs.RS)
+	*r = *x.RS
+	r.DataNum, r.ParityNum, r.GenMatrix = rows, len(gm)/rows, gm
+	return r
+}
 
-	err = x.RS.Update(oldData, newData, row, parity)
+// Update updates parity data when one data vector changes.
+// row is the index of the updated data vector in the full set.
+func (x *XRS) Update(oldData, newData []byte, row int, parity [][]byte) (err error) {
+	w, err := x.borrow()
 	if err != nil {
 		return
 	}
+	defer w.release()
+	return w.Update(oldData, newData, row, parity)
+}
 
-	_, bNeed, err := x.GetNeedVects(row)
+// UpdateMany is as same as calling Update for each row,
+// but it updates all parity vectors in a single pass:
+// oldData[i] and newData[i] are the old and new data of vector rows[i].
+//
+// XRS is linear, so parity is updated with the deltas (oldData ⊕ newData),
+// and the XOR terms carried by the same parity vector are XOR-ed together.
+func (x *XRS) UpdateMany(oldData, newData [][]byte, rows []int, parity [][]byte) (err error) {
+	w, err := x.borrow()
 	if err != nil {
 		return
 	}
-	half := len(oldData) / 2
-	src := make([][]byte, 3)
-	bv := parity[bNeed[1]-x.RS.DataNum][half:]
-	src[0], src[1], src[2] = oldData[:half], newData[:half], bv
-	xor.Encode(bv, src)
-	return
+	defer w.release()
+	return w.UpdateMany(oldData, newData, rows, parity)
 }
 
 // Replace replaces oldData vectors with zero vectors, or replaces zero vectors
@@ -361,29 +785,12 @@ func (x *XRS) Update(oldData, newData []byte, row int, parity [][]byte) (err err
 //
 // data indexes and replaceRows must use the same order.
 func (x *XRS) Replace(data [][]byte, replaceRows []int, parity [][]byte) (err error) {
-
-	err = checkSize(data[0])
-	if err != nil {
-		return
-	}
-
-	err = x.RS.Replace(data, replaceRows, parity)
+	w, err := x.borrow()
 	if err != nil {
 		return
 	}
-
-	for i := range replaceRows {
-		_, bNeed, err2 := x.GetNeedVects(replaceRows[i])
-		if err2 != nil {
-			return err2
-		}
-
-		half := len(data[0]) / 2
-		bv := parity[bNeed[1]-x.RS.DataNum][half:]
-		xor.Encode(bv, [][]byte{bv, data[i][:half]})
-	}
-
-	return
+	defer w.release()
+	return w.Replace(data, replaceRows, parity)
 }
 
 func isIn(e int, s []int) bool {
@@ -7,11 +7,14 @@ package xrs
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"sort"
 	"testing"
 	"time"
+
+	rs "github.com/templexxx/reedsolomon"
 )
 
 const (
@@ -121,6 +124,44 @@ func TestXRS_Encode(t *testing.T) {
 	}
 }
 
+func TestXRS_EncodeConcurrent(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, size := range []int{sub, sub * 33, sub * (3*minEncodePart + 7)} {
+			exp := newShardMatrix(d+p, size)
+			for j := 0; j < d; j++ {
+				fillRandom(t, r, exp[j])
+			}
+			err = x.Encode(exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, workers := range []int{0, 1, 2, 3, 64, 1 << 62, int(^uint(0) >> 1)} {
+				act := newShardMatrix(d+p, size)
+				for j := 0; j < d; j++ {
+					copy(act[j], exp[j])
+				}
+				err = x.EncodeConcurrent(act, workers)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for j := range exp {
+					if !bytes.Equal(exp[j], act[j]) {
+						t.Fatalf("encodeConcurrent failed: vect %d mismatch; size: %d, workers: %d", j, size, workers)
+					}
+				}
+			}
+		}
+	}
+}
+
 func TestXRS_GetNeedVects(t *testing.T) {
 	for d := 1; d <= 255; d++ {
 		for p := 2; p <= 255; p++ {
@@ -155,11 +196,196 @@ func TestXRS_GetNeedVects(t *testing.T) {
 	}
 }
 
+// An XRS made by a literal without Substripes works as two halves.
+func TestXRS_Literal(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lx := &XRS{RS: x.RS, XORSet: x.XORSet}
+
+	exp := newShardMatrix(d+p, testShardSize)
+	act := newShardMatrix(d+p, testShardSize)
+	for j := 0; j < d; j++ {
+		fillRandom(t, r, exp[j])
+		copy(act[j], exp[j])
+	}
+	err = x.Encode(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lx.Encode(act)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVectsEqual(t, exp, act, "encode")
+
+	act[0] = make([]byte, testShardSize)
+	err = lx.ReconstOne(act, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVectsEqual(t, exp, act, "reconstOne")
+
+	err = lx.Encode(newShardMatrix(d+p, 3))
+	if !errors.Is(err, ErrOddVectSize) {
+		t.Fatalf("mismatch error: %v, exp: %v", err, ErrOddVectSize)
+	}
+}
+
+// XORSet assigned by the caller with a key out of range must be rejected,
+// not wrapped onto another parity vector.
+func TestXRS_IllegalXORSetKey(t *testing.T) {
+	d, p := 4, 3
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.XORSet = map[int][]int{d: {0, 1}, d + 2: {2, 3}} // d is the first parity.
+
+	if _, ok := x.slot(d, 0); ok {
+		t.Fatal("slot should reject key of the first parity")
+	}
+	if _, ok := x.slot(d+p, 0); ok {
+		t.Fatal("slot should reject key out of vects")
+	}
+	if _, ok := x.xorKey(0); ok {
+		t.Fatal("xorKey should reject key of the first parity")
+	}
+	_, _, err = x.GetNeedVects(0)
+	if !errors.Is(err, ErrIllegalXORSet) {
+		t.Fatalf("mismatch error: %v, exp: %v", err, ErrIllegalXORSet)
+	}
+	err = x.ReconstOne(newShardMatrix(d+p, 64), 0)
+	if !errors.Is(err, ErrIllegalXORSet) {
+		t.Fatalf("mismatch error: %v, exp: %v", err, ErrIllegalXORSet)
+	}
+}
+
+func TestNewWithSubstripes(t *testing.T) {
+	for _, r := range []int{-1, 0, 1, testParityShards + 1} {
+		_, err := NewWithSubstripes(testDataShards, testParityShards, r)
+		if err == nil {
+			t.Fatalf("substripes %d should be illegal", r)
+		}
+	}
+	for r := 2; r <= testParityShards; r++ {
+		x, err := NewWithSubstripes(testDataShards, testParityShards, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.Substripes != r {
+			t.Fatal("mismatch substripes")
+		}
+	}
+}
+
+// Every data sub-stripe except the last one must be XOR-ed into
+// exactly one parity, and sub-stripes of the same data vector
+// must go to different parities.
+func TestXRS_Terms(t *testing.T) {
+	for d := 1; d <= 20; d++ {
+		for p := 2; p <= 8; p++ {
+			for r := 2; r <= p; r++ {
+				x, err := NewWithSubstripes(d, p, r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cnt := make(map[term]int)
+				for i := d + 1; i < d+p; i++ {
+					idx := make([]int, 0)
+					for _, tm := range x.terms(i) {
+						cnt[tm]++
+						if isIn(tm.index, idx) {
+							t.Fatal("sub-stripes of the same data in one parity", d, p, r)
+						}
+						idx = append(idx, tm.index)
+					}
+				}
+				if len(cnt) != d*(r-1) {
+					t.Fatal("mismatch terms count", d, p, r)
+				}
+				for tm, c := range cnt {
+					if c != 1 || tm.sub >= r-1 {
+						t.Fatal("illegal term", d, p, r, tm, c)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestXRS_EncodeSubstripes(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := sub * 64
+		act := newShardMatrix(d+p, size)
+		exp := newShardMatrix(d+p, size)
+		for j := 0; j < d; j++ {
+			fillRandom(t, r, act[j])
+			copy(exp[j], act[j])
+		}
+		err = x.Encode(act)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Make expect by the definition.
+		err = x.RS.Encode(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < d; j++ {
+			key, ok := x.xorKey(j)
+			if !ok {
+				t.Fatal("data not in XORSet")
+			}
+			for s := 0; s < sub-1; s++ {
+				e, _ := x.slot(key, s)
+				b := x.sub(exp[e], sub-1)
+				a := x.sub(exp[j], s)
+				for k := range b {
+					b[k] ^= a[k]
+				}
+			}
+		}
+		for j := range exp {
+			if !bytes.Equal(exp[j], act[j]) {
+				t.Fatalf("encode failed: substripes: %d, vect %d mismatch", sub, j)
+			}
+		}
+	}
+
+	x, err := NewWithSubstripes(d, p, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = x.Encode(newShardMatrix(d+p, 4))
+	if err == nil {
+		t.Fatal("vect size should be illegal")
+	}
+}
+
 func TestXRS_ReconstOne(t *testing.T) {
-	testReconstOne(t, testDataShards, testParityShards, 2)
+	testReconstOne(t, testDataShards, testParityShards, 2, 2)
+}
+
+func TestXRS_ReconstOneSubstripes(t *testing.T) {
+	for r := 2; r <= testParityShards; r++ {
+		testReconstOne(t, testDataShards, testParityShards, r, r*64)
+	}
+	testReconstOne(t, 10, 9, 3, 3*64)
 }
 
-func testReconstOne(t *testing.T, dataShards, parityShards, size int) {
+func testReconstOne(t *testing.T, dataShards, parityShards, substripes, size int) {
 	r := newTestRand(t)
 
 	for lost := 0; lost < dataShards; lost++ {
@@ -170,7 +396,7 @@ func testReconstOne(t *testing.T, dataShards, parityShards, size int) {
 		for j := 0; j < dataShards; j++ {
 			fillRandom(t, r, expect[j])
 		}
-		x, err := New(dataShards, parityShards)
+		x, err := NewWithSubstripes(dataShards, parityShards, substripes)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -178,50 +404,172 @@ func testReconstOne(t *testing.T, dataShards, parityShards, size int) {
 		if err != nil {
 			t.Fatal(err)
 		}
+
+		// Copy needed sub-stripes only.
+		needReconst := lost
+		last := substripes - 1
+		_, bNeed, err := x.GetNeedVects(needReconst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bNeed) != substripes || bNeed[0] != dataShards {
+			t.Fatal("illegal bNeed", bNeed)
+		}
+		// Copy B.
 		for j := 0; j < dataShards+parityShards; j++ {
-			copy(result[j], expect[j])
+			if (j < dataShards && j != needReconst) || isIn(j, bNeed) {
+				copy(x.sub(result[j], last), x.sub(expect[j], last))
+			}
+		}
+		// Copy A.
+		for _, bi := range bNeed[1:] {
+			for _, tm := range x.terms(bi) {
+				if tm.index != needReconst {
+					copy(x.sub(result[tm.index], tm.sub), x.sub(expect[tm.index], tm.sub))
+				}
+			}
 		}
 
-		// Clean all data except needed.
-		// Clean needReconst.
-		needReconst := lost
-		result[needReconst] = make([]byte, size)
-		// Clean A & B.
-		aVects, bVects := make([][]byte, dataShards+parityShards), make([][]byte, dataShards+parityShards)
-		half := size / 2
-		for j := range result {
-			aVects[j], bVects[j] = result[j][:half], result[j][half:]
+		err = x.ReconstOne(result, needReconst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(result[needReconst], expect[needReconst]) {
+			t.Fatalf("mismatch reconstOne; vect: %d; size: %d", needReconst, size)
+		}
+	}
+}
+
+func TestXRS_ReconstOneSparse(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
 		}
-		aNeed, bNeed, err := x.GetNeedVects(needReconst)
+		size := sub * 64
+		exp := newShardMatrix(d+p, size)
+		for j := 0; j < d; j++ {
+			fillRandom(t, r, exp[j])
+		}
+		err = x.Encode(exp)
 		if err != nil {
 			t.Fatal(err)
 		}
-		// Clean A.
-		for j := range result {
-			if !isIn(j, aNeed) {
-				aVects[j] = make([]byte, half)
+
+		n := size / sub
+		for lost := 0; lost < d; lost++ {
+			plan, err := x.RepairPlan(lost, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Only allocate what the plan needs.
+			parts := make(map[int][][]byte)
+			for _, rr := range plan {
+				if parts[rr.Index] == nil {
+					parts[rr.Index] = make([][]byte, sub)
+				}
+				for off := rr.Offset; off < rr.Offset+rr.Length; off += n {
+					part := make([]byte, n)
+					copy(part, exp[rr.Index][off:off+n])
+					parts[rr.Index][off/n] = part
+				}
+			}
+
+			dst := make([]byte, size)
+			err = x.ReconstOneSparse(parts, lost, dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dst, exp[lost]) {
+				t.Fatalf("mismatch reconstOneSparse; vect: %d, substripes: %d", lost, sub)
+			}
+
+			// Lose a needed part.
+			rr := plan[len(plan)-1]
+			parts[rr.Index][rr.Offset/n] = nil
+			err = x.ReconstOneSparse(parts, lost, dst)
+			if err == nil {
+				t.Fatal("should return error for missing sub-stripe")
 			}
 		}
-		// Clean B.
-		bVects[needReconst] = make([]byte, size)
-		for j := dataShards; j < dataShards+parityShards; j++ {
-			if !isIn(j, bNeed) {
-				bVects[j] = make([]byte, half)
+	}
+}
+
+func TestXRS_GetNeedVectsParity(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{-1, 0, d - 1, d + p} {
+		_, _, err = x.GetNeedVectsParity(i)
+		if err == nil {
+			t.Fatalf("parity index %d should be illegal", i)
+		}
+	}
+	for i := d; i < d+p; i++ {
+		a, b, err := x.GetNeedVectsParity(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a) != d || len(b) != d {
+			t.Fatal("mismatch len")
+		}
+		// a-vectors must cover the XOR terms.
+		for _, tm := range x.terms(i) {
+			if !isIn(tm.index, a) {
+				t.Fatal("missing XOR term")
 			}
 		}
+	}
+}
+
+func TestXRS_ReconstParity(t *testing.T) {
+	for r := 2; r <= testParityShards; r++ {
+		testReconstParity(t, testDataShards, testParityShards, r, r*64)
+	}
+}
 
-		for j := range result {
-			copy(result[j][:half], aVects[j])
-			copy(result[j][half:], bVects[j])
+func testReconstParity(t *testing.T, dataShards, parityShards, substripes, size int) {
+	r := newTestRand(t)
 
+	x, err := NewWithSubstripes(dataShards, parityShards, substripes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for lost := dataShards; lost < dataShards+parityShards; lost++ {
+		exp := newShardMatrix(dataShards+parityShards, size)
+		for j := 0; j < dataShards; j++ {
+			fillRandom(t, r, exp[j])
 		}
-		err = x.ReconstOne(result, needReconst)
+		err = x.Encode(exp)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if !bytes.Equal(result[needReconst], expect[needReconst]) {
-			t.Fatalf("mismatch reconstOne; vect: %d; size: %d", needReconst, size)
+		// Only data vectors are available.
+		act := newShardMatrix(dataShards+parityShards, size)
+		for j := 0; j < dataShards; j++ {
+			copy(act[j], exp[j])
+		}
+		err = x.ReconstParity(act, lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range act {
+			if j >= dataShards && j != lost {
+				if !bytes.Equal(act[j], make([]byte, size)) {
+					t.Fatalf("vect %d should not be touched", j)
+				}
+				continue
+			}
+			if !bytes.Equal(act[j], exp[j]) {
+				t.Fatalf("mismatch reconstParity; vect: %d, lost: %d", j, lost)
+			}
 		}
 	}
 }
@@ -242,14 +590,9 @@ func TestXRS_RetrieveRS(t *testing.T) {
 		copy(results[i], vects[i])
 	}
 
-	err = x.retrieveRS(results, r.Perm(d+p))
-	if err != nil {
-		t.Fatal(err)
-	}
-	err = x.retrieveRS(results, r.Perm(d+p))
-	if err != nil {
-		t.Fatal(err)
-	}
+	w := x.NewWorkspace()
+	w.retrieveRS(results, r.Perm(d+p))
+	w.retrieveRS(results, r.Perm(d+p))
 
 	for i := range vects {
 		if !bytes.Equal(vects[i], results[i]) {
@@ -259,10 +602,16 @@ func TestXRS_RetrieveRS(t *testing.T) {
 }
 
 func TestXRS_Reconst(t *testing.T) {
-	testReconst(t, testDataShards, testParityShards, testShardSize, 128)
+	testReconst(t, testDataShards, testParityShards, 2, testShardSize, 128)
 }
 
-func testReconst(t *testing.T, dataShards, parityShards, size, loop int) {
+func TestXRS_ReconstSubstripes(t *testing.T) {
+	for r := 3; r <= testParityShards; r++ {
+		testReconst(t, testDataShards, testParityShards, r, r*64, 128)
+	}
+}
+
+func testReconst(t *testing.T, dataShards, parityShards, substripes, size, loop int) {
 	r := newTestRand(t)
 
 	for i := 0; i < loop; i++ {
@@ -272,7 +621,7 @@ func testReconst(t *testing.T, dataShards, parityShards, size, loop int) {
 			fillRandom(t, r, exp[j])
 		}
 
-		x, err := New(dataShards, parityShards)
+		x, err := NewWithSubstripes(dataShards, parityShards, substripes)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -313,11 +662,343 @@ func testReconst(t *testing.T, dataShards, parityShards, size, loop int) {
 	}
 }
 
+func TestXRS_ReconstPreserveInputs(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	for sub := 2; sub <= p; sub++ {
+		x, err := NewWithSubstripes(d, p, sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := x.NewWorkspace()
+		fs := map[string]func([][]byte, []int, []int) error{
+			"XRS":       x.ReconstPreserveInputs,
+			"Workspace": w.ReconstPreserveInputs,
+		}
+		for name, f := range fs {
+			for i := 0; i < 32; i++ {
+				exp := newShardMatrix(d+p, sub*64)
+				for j := 0; j < d; j++ {
+					fillRandom(t, r, exp[j])
+				}
+				err = x.Encode(exp)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				lost := makeLostRandom(r, d+p, 1+r.Intn(p))
+				needReconst := append([]int(nil), lost[:1+r.Intn(len(lost))]...)
+				dpHas := makeHasFromLost(d+p, lost)
+				act := newShardMatrix(d+p, sub*64)
+				for _, h := range dpHas {
+					copy(act[h], exp[h])
+				}
+				err = f(act, dpHas, needReconst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, n := range append(dpHas, needReconst...) {
+					if !bytes.Equal(act[n], exp[n]) {
+						t.Fatalf("%s: vect %d mismatch, lost: %v, need: %v", name, n, lost, needReconst)
+					}
+				}
+				if len(needReconst) == len(lost) {
+					ok, err := x.Verify(act)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !ok {
+						t.Fatalf("%s: verify failed", name)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Step 3 of Reconst fails after the parity vectors in dpHas have been
+// converted to RS form, they must be converted back.
+func TestXRS_ReconstFailed(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := newShardMatrix(d+p, testShardSize)
+	for j := 0; j < d; j++ {
+		fillRandom(t, r, exp[j])
+	}
+	err = x.Encode(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lost := []int{0, 1, d + 1}
+	needReconst := []int{0, 1}
+	dpHas := makeHasFromLost(d+p, lost)
+
+	// Break the decoder of Step 3 (b-vectors).
+	var key decodeKey
+	for _, i := range dpHas[:d] {
+		key.has[i>>6] |= 1 << uint(i&63)
+	}
+	for _, i := range needReconst {
+		key.need[i>>6] |= 1 << uint(i&63)
+	}
+	broken, err := rs.New(d, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.layout().decoders.Store(key, broken)
+
+	w := x.NewWorkspace()
+	fs := map[string]func([][]byte, []int, []int) error{
+		"Reconst":                         x.Reconst,
+		"ReconstPreserveInputs":           x.ReconstPreserveInputs,
+		"Workspace.Reconst":               w.Reconst,
+		"Workspace.ReconstPreserveInputs": w.ReconstPreserveInputs,
+	}
+	for name, f := range fs {
+		act := newShardMatrix(d+p, testShardSize)
+		for _, i := range dpHas {
+			copy(act[i], exp[i])
+		}
+		err = f(act, dpHas, needReconst)
+		if err == nil {
+			t.Fatalf("%s: should fail with broken decoder", name)
+		}
+		for _, i := range dpHas {
+			if !bytes.Equal(act[i], exp[i]) {
+				t.Fatalf("%s: vect %d in dpHas is modified", name, i)
+			}
+		}
+	}
+}
+
+// Reconst must not rebuild lost vectors which are not needed.
+func TestXRS_ReconstOnlyNeeded(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := newShardMatrix(d+p, testShardSize)
+	for j := 0; j < d; j++ {
+		fillRandom(t, r, exp[j])
+	}
+	err = x.Encode(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key5, _ := x.xorKey(5)
+
+	cases := []struct {
+		lost, needReconst, untouched []int
+	}{
+		{[]int{0, d + 1}, []int{0}, []int{d + 1}},
+		{[]int{0, 5, key5}, []int{0}, []int{5, key5}},
+		{[]int{0, 5, d}, []int{d}, []int{}}, // Parity needs all data.
+		{[]int{0, 5}, []int{0}, []int{}},    // 5 is a term of available parity.
+	}
+	w := x.NewWorkspace()
+	fs := map[string]func([][]byte, []int, []int) error{
+		"XRS":       x.Reconst,
+		"Workspace": w.Reconst,
+	}
+	for name, f := range fs {
+		for _, c := range cases {
+			dpHas := makeHasFromLost(d+p, c.lost)
+			act := newShardMatrix(d+p, testShardSize)
+			for i := range act {
+				if isIn(i, dpHas) {
+					copy(act[i], exp[i])
+					continue
+				}
+				for j := range act[i] {
+					act[i][j] = 0xaa
+				}
+			}
+			err = f(act, dpHas, append([]int(nil), c.needReconst...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range c.needReconst {
+				if !bytes.Equal(act[n], exp[n]) {
+					t.Fatalf("%s: reconst failed: vect: %d, lost: %v", name, n, c.lost)
+				}
+			}
+			for _, n := range c.untouched {
+				for _, b := range act[n] {
+					if b != 0xaa {
+						t.Fatalf("%s: vect %d shouldn't be touched, lost: %v", name, n, c.lost)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Reconst must not take the ReconstOne shortcut
+// when vectors required by it are lost.
+func TestXRS_ReconstOneFallback(t *testing.T) {
+	d, p := testDataShards, testParityShards
+	r := newTestRand(t)
+
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for lost := 0; lost < d; lost++ {
+		exp := newShardMatrix(d+p, testShardSize)
+		for j := 0; j < d; j++ {
+			fillRandom(t, r, exp[j])
+		}
+		err = x.Encode(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, bNeed, err := x.GetNeedVects(lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		act := newShardMatrix(d+p, testShardSize)
+		for j := range act {
+			copy(act[j], exp[j])
+		}
+		lostB := bNeed[r.Intn(len(bNeed))]
+		act[lost], act[lostB] = make([]byte, testShardSize), make([]byte, testShardSize)
+		err = x.Reconst(act, makeHasFromLost(d+p, []int{lost, lostB}), []int{lost})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(exp[lost], act[lost]) {
+			t.Fatalf("reconst failed: vect: %d, lost: %d", lost, lostB)
+		}
+	}
+}
+
+// parityNum == 1 works as plain Reed-Solomon.
+func TestXRS_SingleParity(t *testing.T) {
+	d, p := 4, 1
+	r := newTestRand(t)
+
+	x, err := New(d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(x.XORSet) != 0 {
+		t.Fatal("XORSet should be empty", x.XORSet)
+	}
+	for _, sub := range []int{1, 3} {
+		_, err = NewWithSubstripes(d, p, sub)
+		if err == nil {
+			t.Fatalf("substripes %d should be illegal", sub)
+		}
+	}
+
+	exp := newShardMatrix(d+p, testShardSize)
+	for j := 0; j < d; j++ {
+		fillRandom(t, r, exp[j])
+	}
+	err = x.Encode(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsExp := newShardMatrix(d+p, testShardSize)
+	for j := 0; j < d; j++ {
+		copy(rsExp[j], exp[j])
+	}
+	err = x.RS.Encode(rsExp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVectsEqual(t, rsExp, exp, "encode")
+	ok, err := x.Verify(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("verify failed")
+	}
+	bad, err := x.LocateCorruption(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bad) != 0 {
+		t.Fatal("should have no corruption", bad)
+	}
+	desc, err := x.Descriptor(testShardSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewFromDescriptor(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for lost := 0; lost < d; lost++ {
+		aNeed, bNeed, err := x.GetNeedVects(lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bNeed) != 1 || bNeed[0] != d || len(aNeed) != d || isIn(lost, aNeed) || !isIn(d, aNeed) {
+			t.Fatalf("need vects mismatch: a: %v, b: %v", aNeed, bNeed)
+		}
+
+		act := newShardMatrix(d+p, testShardSize)
+		for _, i := range aNeed {
+			copy(act[i], exp[i])
+		}
+		err = x.ReconstOne(act, lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertVectsEqual(t, exp, act, "reconstOne")
+
+		act = newShardMatrix(d+p, testShardSize)
+		for _, i := range aNeed {
+			copy(act[i], exp[i])
+		}
+		err = x.NewWorkspace().ReconstOne(act, lost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertVectsEqual(t, exp, act, "workspace reconstOne")
+
+		plan, err := x.RepairPlan(lost, testShardSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, rr := range plan {
+			total += rr.Length
+		}
+		if total != d*testShardSize {
+			t.Fatalf("repair plan mismatch: read %d bytes, exp: %d", total, d*testShardSize)
+		}
+	}
+
+	testReconst(t, d, p, 2, testShardSize, 32)
+	testReconstParity(t, d, p, 2, testShardSize)
+	testUpdate(t, d, p, 2, testShardSize)
+	testReplace(t, d, p, 2, testShardSize, 8, false)
+	testReplace(t, d, p, 2, testShardSize, 8, true)
+}
+
 func TestXRS_Update(t *testing.T) {
-	testUpdate(t, testDataShards, testParityShards, testShardSize)
+	testUpdate(t, testDataShards, testParityShards, 2, testShardSize)
+	for r := 3; r <= testParityShards; r++ {
+		testUpdate(t, testDataShards, testParityShards, r, r*64)
+	}
 }
 
-func testUpdate(t *testing.T, dataShards, parityShards, size int) {
+func testUpdate(t *testing.T, dataShards, parityShards, substripes, size int) {
 	r := newTestRand(t)
 
 	for i := 0; i < dataShards; i++ {
@@ -328,7 +1009,7 @@ func testUpdate(t *testing.T, dataShards, parityShards, size int) {
 			copy(act[j], exp[j])
 		}
 
-		x, err := New(dataShards, parityShards)
+		x, err := NewWithSubstripes(dataShards, parityShards, substripes)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -358,12 +1039,64 @@ func testUpdate(t *testing.T, dataShards, parityShards, size int) {
 	}
 }
 
+func TestXRS_UpdateMany(t *testing.T) {
+	testUpdateMany(t, testDataShards, testParityShards, 2, testShardSize)
+	testUpdateMany(t, testDataShards, testParityShards, 3, 3*64)
+	testUpdateMany(t, 10, 1, 2, testShardSize)
+}
+
+func testUpdateMany(t *testing.T, dataShards, parityShards, substripes, size int) {
+	r := newTestRand(t)
+
+	x, err := NewWithSubstripes(dataShards, parityShards, substripes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 64; i++ {
+		act := newShardMatrix(dataShards+parityShards, size)
+		exp := newShardMatrix(dataShards+parityShards, size)
+		for j := 0; j < dataShards; j++ {
+			fillRandom(t, r, exp[j])
+			copy(act[j], exp[j])
+		}
+		err = x.Encode(act)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows := makeReplaceRowsRandom(r, dataShards)
+		oldData := make([][]byte, len(rows))
+		newData := newShardMatrix(len(rows), size)
+		for j, row := range rows {
+			oldData[j] = act[row]
+			fillRandom(t, r, newData[j])
+			copy(exp[row], newData[j])
+		}
+		err = x.UpdateMany(oldData, newData, rows, act[dataShards:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = x.Encode(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := dataShards; j < dataShards+parityShards; j++ {
+			if !bytes.Equal(act[j], exp[j]) {
+				t.Fatalf("update many failed: vect: %d, rows: %v", j, rows)
+			}
+		}
+	}
+}
+
 func TestXRS_Replace(t *testing.T) {
-	testReplace(t, testDataShards, testParityShards, testShardSize, 1024, true)
-	testReplace(t, testDataShards, testParityShards, testShardSize, 1024, false)
+	testReplace(t, testDataShards, testParityShards, 2, testShardSize, 1024, true)
+	testReplace(t, testDataShards, testParityShards, 2, testShardSize, 1024, false)
+	testReplace(t, testDataShards, testParityShards, 3, 3*64, 128, true)
+	testReplace(t, testDataShards, testParityShards, 4, 4*64, 128, false)
 }
 
-func testReplace(t *testing.T, dataShards, parityShards, size, loop int, toZero bool) {
+func testReplace(t *testing.T, dataShards, parityShards, substripes, size, loop int, toZero bool) {
 	r := newTestRand(t)
 
 	for i := 0; i < loop; i++ {
@@ -387,7 +1120,7 @@ func testReplace(t *testing.T, dataShards, parityShards, size, loop int, toZero
 			}
 		}
 
-		x, err := New(dataShards, parityShards)
+		x, err := NewWithSubstripes(dataShards, parityShards, substripes)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -495,6 +1228,44 @@ func benchmarkEncode(f func(*testing.B, int, int, int), dps [][]int, sizes []int
 	}
 }
 
+func BenchmarkXRS_EncodeConcurrent(b *testing.B) {
+	dps := [][]int{
+		{12, 4},
+	}
+
+	sizes := []int{
+		mb,
+		8 * mb,
+	}
+
+	b.Run("", benchmarkEncode(benchEncConcurrent, dps, sizes))
+}
+
+func benchEncConcurrent(b *testing.B, d, p, size int) {
+
+	vects := make([][]byte, d+p)
+	for j := 0; j < d+p; j++ {
+		vects[j] = make([]byte, size)
+	}
+	r := newTestRand(b)
+	for j := 0; j < d; j++ {
+		fillRandom(b, r, vects[j])
+	}
+	x, err := New(d, p)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64((d + p) * size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err = x.EncodeConcurrent(vects, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func benchEnc(b *testing.B, d, p, size int) {
 
 	vects := make([][]byte, d+p)